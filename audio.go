@@ -0,0 +1,52 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// The most audio which may be queued before frames are dropped, in frames.
+// This bounds the latency of the sound should the emulation outpace the sound card.
+const maxQueuedFrames = 4
+
+// An audio sink which queues the synthesized samples on an SDL audio device.
+type sdlSink struct {
+	device sdl.AudioDeviceID  // The device being played to.
+	synth  *chip8.Synthesizer // The synthesizer of the samples.
+	buffer []byte             // The samples of the current frame; reused between frames.
+}
+
+// Opens the default audio device, playing a square wave of the given frequency and volume.
+// SDL's audio subsystem must have been initialized.
+func newSDLSink(frequency, volume float64) (*sdlSink, error) {
+	spec := sdl.AudioSpec{
+		Freq:     chip8.SampleRate,
+		Format:   sdl.AUDIO_U8,
+		Channels: 1,
+		Samples:  1024,
+	}
+	device, err := sdl.OpenAudioDevice("", false, &spec, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	sdl.PauseAudioDevice(device, false)
+	return &sdlSink{device: device, synth: chip8.NewSynthesizer(frequency, volume)}, nil
+}
+
+// Queues the frame's samples for playback.
+func (sink *sdlSink) PlayFrame(sound chip8.Sound) {
+	if sdl.GetQueuedAudioSize(sink.device) > maxQueuedFrames*chip8.SamplesPerFrame {
+		return
+	}
+	sink.buffer = sink.synth.Synthesize(sink.buffer[:0], sound)
+	sdl.QueueAudio(sink.device, sink.buffer)
+}
+
+// Closes the audio device.
+func (sink *sdlSink) Close() {
+	sdl.CloseAudioDevice(sink.device)
+}
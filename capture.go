@@ -0,0 +1,79 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"log"
+	"os"
+	"time"
+)
+
+// A capture of the frames the machine runs, to a file beside the program.
+// Frames are captured as the machine completes them, so the video keeps the
+// emulation's time whatever the window's refresh rate, and skips pauses.
+type windowCapture struct {
+	machine  *chip8.Machine // The machine being captured.
+	filename string         // The file being captured to.
+	file     *os.File       // The open file.
+	video    chip8.Capture  // The video being written to the file.
+	screen   *chip8.Screen  // Presents frames to the video.
+	failed   bool           // Whether a frame couldn't be written, ending the video.
+}
+
+// Starts capturing the machine to a new file named after the program and the time,
+// in the format chosen on the command line. Returns nil if the capture couldn't be started.
+func startCapture(machine *chip8.Machine) *windowCapture {
+	filename := fmt.Sprintf("%s.%s.%s", *filenameFlag, time.Now().Format("20060102-150405"), *captureFlag)
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Print("Failed to create capture file. ", err)
+		return nil
+	}
+	video, err := chip8.NewCapture(filename, file, *scaleFlag)
+	if err != nil {
+		file.Close()
+		log.Print("Failed to start capture. ", err)
+		return nil
+	}
+	screen := chip8.NewScreen(video)
+	screen.SetPalette(palette)
+	log.Printf("Capturing to %s; press %s to stop", filename, sdl.GetKeyName(hotkeys.Capture))
+	capture := &windowCapture{machine: machine, filename: filename, file: file, video: video, screen: screen}
+	machine.Observe(capture)
+	return capture
+}
+
+// Adds the frame just completed to the capture, as the machine begins the next.
+// Should the frame not be written, the capture ends without stopping the machine.
+func (capture *windowCapture) BeginFrame(frame int, cpu *chip8.CPU) error {
+	if capture.failed {
+		return nil
+	}
+	if err := capture.screen.Present(&cpu.Pixels); err != nil {
+		log.Print("Failed to capture frame. ", err)
+		capture.failed = true
+	}
+	return nil
+}
+
+// Completes the capture and closes its file; nothing happens if the capture is nil.
+func (capture *windowCapture) stop() {
+	if capture == nil {
+		return
+	}
+	capture.machine.Unobserve(capture)
+	defer capture.file.Close()
+	if capture.failed {
+		return
+	}
+	if err := capture.video.Close(); err != nil {
+		log.Print("Failed to write capture file. ", err)
+		return
+	}
+	log.Printf("Captured to %s", capture.filename)
+}
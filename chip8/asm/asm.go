@@ -0,0 +1,501 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+// This package implements an assembler for Chip 8 programs.
+//
+// It accepts the CHIPPER syntax used by the sources in programs/GAMES/SOURCES,
+// along with the extensions used by the BISQWIT sources: several statements
+// per line separated by ':', @local labels scoped to the preceding label,
+// .byte strings, 'if condition : statement' and SHR()/AND() expressions.
+// The older mnemonics of Paul Robson's assembler (mov, jsr, skeq and so on)
+// are accepted as aliases, as are the disassembler's listings.
+package asm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// The maximum number of passes made before giving up on symbols settling.
+const maxPasses = 8
+
+// An assembled program.
+type Program struct {
+	Origin  uint16   // The address the program is to be loaded at.
+	Bytes   []byte   // The assembled program image.
+	Symbols []Symbol // The labels and constants defined by the program, ordered by value.
+}
+
+// A label or constant defined by a program.
+type Symbol struct {
+	Name  string // The symbol, as spelled where it was defined; local labels are prefixed with their scope.
+	Value int    // The address or value of the symbol.
+	Line  int    // The line the symbol was defined on.
+}
+
+// Writes a symbol map of the program, one symbol per line, e.g. 0204 LOOP.
+func (program *Program) WriteSymbols(writer io.Writer) error {
+	buffer := bufio.NewWriter(writer)
+	for _, symbol := range program.Symbols {
+		fmt.Fprintf(buffer, "%04X %s\n", uint16(symbol.Value), symbol.Name)
+	}
+	return buffer.Flush()
+}
+
+// An error in the source, along with where it occurred.
+type Error struct {
+	Filename string // The name of the source file.
+	Line     int    // The line of the error, starting from 1.
+	Message  string // What went wrong.
+}
+
+// Describes the error in the conventional file:line: message form.
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s:%d: %s", err.Filename, err.Line, err.Message)
+}
+
+// All of the errors found in a source file, in line order.
+type ErrorList []*Error
+
+// Describes each of the errors, one per line.
+func (list ErrorList) Error() string {
+	messages := make([]string, len(list))
+	for i, err := range list {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Assembles the given source, as loaded at the given origin (typically 0x200).
+// The filename is used only to report errors, which are returned as an ErrorList.
+func Assemble(filename string, source []byte, origin uint16) (*Program, error) {
+	lines := strings.Split(strings.Replace(string(source), "\r\n", "\n", -1), "\n")
+
+	// forward references are resolved by repeating passes until every symbol settles
+	var a *assembler
+	var previous map[string]*Symbol
+	for pass := 1; pass <= maxPasses; pass++ {
+		a = newAssembler(filename, origin, previous)
+		a.run(lines)
+		if pass > 1 && sameSymbols(a.symbols, previous) {
+			break
+		}
+		if pass == maxPasses {
+			a.errorf("symbols did not settle after %d passes", maxPasses)
+		}
+		previous = a.symbols
+	}
+
+	if len(a.errors) > 0 {
+		sort.SliceStable(a.errors, func(i, j int) bool { return a.errors[i].Line < a.errors[j].Line })
+		return nil, a.errors
+	}
+
+	program := &Program{Origin: origin, Bytes: a.output}
+	for _, symbol := range a.symbols {
+		program.Symbols = append(program.Symbols, *symbol)
+	}
+	sort.Slice(program.Symbols, func(i, j int) bool {
+		if program.Symbols[i].Value != program.Symbols[j].Value {
+			return program.Symbols[i].Value < program.Symbols[j].Value
+		}
+		return program.Symbols[i].Name < program.Symbols[j].Name
+	})
+	return program, nil
+}
+
+// Determines if two passes produced the same symbols.
+func sameSymbols(a, b map[string]*Symbol) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, symbol := range a {
+		other, ok := b[key]
+		if !ok || other.Value != symbol.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// The state of a single pass over the source.
+type assembler struct {
+	filename string             // The name of the source file, for errors.
+	origin   int                // The address the output is loaded at.
+	output   []byte             // The assembled bytes so far.
+	symbols  map[string]*Symbol // The symbols defined so far this pass, by lower case name.
+	previous map[string]*Symbol // The symbols defined by the previous pass, for forward references.
+	defines  map[string]bool    // The names given to DEFINE, for IFDEF.
+	scope    string             // The label which @local labels belong to.
+	pending  []*Symbol          // Labels waiting for the address of the next instruction or data.
+	align    bool               // Whether instructions are aligned to even addresses.
+	unpadded bool               // Whether the last data came from BISQWIT's .byte, which is never padded.
+	skipping []bool             // Whether each enclosing IFDEF block is being skipped.
+	ended    bool               // Whether an END directive has been reached.
+	line     int                // The line being assembled.
+	errors   ErrorList          // The errors found so far this pass.
+}
+
+// Creates the state for a pass over the source.
+func newAssembler(filename string, origin uint16, previous map[string]*Symbol) *assembler {
+	return &assembler{
+		filename: filename,
+		origin:   int(origin),
+		symbols:  make(map[string]*Symbol),
+		previous: previous,
+		defines:  make(map[string]bool),
+		align:    true,
+	}
+}
+
+// Assembles every line of the source.
+func (a *assembler) run(lines []string) {
+	for i, line := range lines {
+		if a.ended {
+			break
+		}
+		a.line = i + 1
+		a.assembleLine(line)
+	}
+	a.line = len(lines)
+	a.placeLabels()
+	if len(a.skipping) > 0 {
+		a.errorf("missing ENDIF")
+	}
+}
+
+// Assembles each of the statements on a line.
+func (a *assembler) assembleLine(line string) {
+	pieces := splitOutsideQuotes(stripComment(line), ':')
+
+	for i := 0; i < len(pieces); i++ {
+		text := strings.TrimSpace(pieces[i])
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+
+		// a single word followed by a colon is a label
+		if i < len(pieces)-1 && len(fields) == 1 {
+			if a.isSkipping() {
+				continue
+			}
+			// which may in turn be given a value, e.g. TopLine: equ 0
+			if next := strings.Fields(pieces[i+1]); len(next) > 0 && strings.EqualFold(next[0], "equ") {
+				a.assign(text, strings.TrimSpace(pieces[i+1])[len(next[0]):])
+				i++
+				continue
+			}
+			a.label(text)
+			continue
+		}
+
+		// the condition of an if applies to the statement which follows it
+		if strings.EqualFold(fields[0], "if") && !a.isSkipping() {
+			a.condition(strings.TrimSpace(text[len(fields[0]):]))
+			continue
+		}
+
+		a.statement(text, fields)
+	}
+}
+
+// Assembles a single statement: a directive, instruction or assignment.
+func (a *assembler) statement(text string, fields []string) {
+	keyword := strings.ToUpper(fields[0])
+	operands := strings.TrimSpace(text[len(fields[0]):])
+
+	if a.conditional(keyword, operands) || a.isSkipping() {
+		return
+	}
+
+	// NAME = value, or NAME EQU value
+	if name := leadingIdentifier(text); name != "" && !strings.EqualFold(name, "if") {
+		rest := strings.TrimSpace(text[len(name):])
+		if strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==") {
+			a.assign(name, rest[1:])
+			return
+		}
+		if len(fields) > 1 && strings.EqualFold(fields[1], "equ") {
+			a.assign(name, rest[len(fields[1]):])
+			return
+		}
+	}
+
+	// CHIPPER also allows a label without a colon, at the start of a statement
+	if !isKeyword(keyword) && len(fields) > 1 && isKeyword(strings.ToUpper(fields[1])) {
+		a.label(fields[0])
+		a.statement(operands, fields[1:])
+		return
+	}
+
+	if a.directive(keyword, operands) {
+		return
+	}
+	if isMnemonic(keyword) {
+		a.instruction(keyword, operands)
+		return
+	}
+	a.errorf("unknown instruction %s", fields[0])
+}
+
+// Handles the conditional assembly directives, reporting whether the keyword was one.
+func (a *assembler) conditional(keyword, operands string) bool {
+	switch keyword {
+	case "IFDEF", "IFNDEF":
+		defined := a.defines[strings.ToLower(operands)]
+		a.skipping = append(a.skipping, a.isSkipping() || defined != (keyword == "IFDEF"))
+	case "ELSE":
+		if len(a.skipping) == 0 {
+			a.errorf("ELSE without IFDEF")
+			return true
+		}
+		last := len(a.skipping) - 1
+		outer := last > 0 && a.skipping[last-1]
+		a.skipping[last] = outer || !a.skipping[last]
+	case "ENDIF":
+		if len(a.skipping) == 0 {
+			a.errorf("ENDIF without IFDEF")
+			return true
+		}
+		a.skipping = a.skipping[:len(a.skipping)-1]
+	default:
+		return false
+	}
+	return true
+}
+
+// Determines if statements are currently being skipped by an IFDEF.
+func (a *assembler) isSkipping() bool {
+	return len(a.skipping) > 0 && a.skipping[len(a.skipping)-1]
+}
+
+// Handles the remaining directives, reporting whether the keyword was one.
+func (a *assembler) directive(keyword, operands string) bool {
+	switch keyword {
+	case "DB":
+		a.unpadded = false
+		a.data(operands, 1)
+	case "DW":
+		a.unpadded = false
+		a.data(operands, 2)
+	case ".BYTE", ".DB":
+		// BISQWIT's assembler never pads the instructions which follow its data
+		a.unpadded = true
+		a.data(operands, 1)
+	case ".WORD", ".DW":
+		a.unpadded = true
+		a.data(operands, 2)
+	case "DA":
+		a.unpadded = false
+		text, _, err := parseString(operands)
+		if err != nil {
+			a.errorf("%v", err)
+			return true
+		}
+		a.emit([]byte(text)...)
+	case "ALIGN":
+		switch strings.ToUpper(operands) {
+		case "ON":
+			a.align = true
+		case "OFF":
+			a.align = false
+		default:
+			a.errorf("ALIGN expects ON or OFF")
+		}
+	case "DEFINE":
+		a.defines[strings.ToLower(operands)] = true
+	case "UNDEF":
+		delete(a.defines, strings.ToLower(operands))
+	case "END":
+		a.ended = true
+	case "OPTION", "XREF", "USED":
+		// listing and target options, which don't affect the output
+	default:
+		return false
+	}
+	return true
+}
+
+// Emits each of the comma separated values or strings, in bytes or big-endian words.
+func (a *assembler) data(operands string, size int) {
+	items := splitOutsideQuotes(operands, ',')
+	for i, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" && i == len(items)-1 && i > 0 {
+			break // a trailing comma
+		}
+		if size == 1 && len(item) > 0 && (item[0] == '"' || item[0] == '\'') {
+			if text, n, err := parseString(item); err == nil && n == len(item) {
+				a.emit([]byte(text)...)
+				continue
+			}
+		}
+		value, _ := a.evaluate(item)
+		if size == 1 {
+			a.checkRange(value, -128, 0xFF, item)
+			a.emit(byte(value))
+		} else {
+			a.checkRange(value, -0x8000, 0xFFFF, item)
+			a.emit(byte(value>>8), byte(value))
+		}
+	}
+}
+
+// Defines a label at the address of the next instruction or data.
+func (a *assembler) label(name string) {
+	symbol := a.define(name, a.address())
+	if symbol == nil {
+		return
+	}
+	if !strings.HasPrefix(name, "@") {
+		a.scope = name
+	}
+	a.pending = append(a.pending, symbol)
+}
+
+// Defines a constant with the value of the given expression.
+func (a *assembler) assign(name, expression string) {
+	value, _ := a.evaluate(strings.TrimSpace(expression))
+	a.define(name, value)
+}
+
+// Defines a symbol, returning nil if it's already been defined.
+func (a *assembler) define(name string, value int) *Symbol {
+	key, spelling := a.qualify(name)
+	if existing, ok := a.symbols[key]; ok {
+		a.errorf("%s is already defined on line %d", name, existing.Line)
+		return nil
+	}
+	symbol := &Symbol{Name: spelling, Value: value, Line: a.line}
+	a.symbols[key] = symbol
+	return symbol
+}
+
+// Resolves a symbol from this pass, or failing that the previous pass.
+func (a *assembler) resolve(name string) (int, bool) {
+	key, _ := a.qualify(name)
+	if symbol, ok := a.symbols[key]; ok {
+		return symbol.Value, true
+	}
+	if symbol, ok := a.previous[key]; ok {
+		return symbol.Value, true
+	}
+	return 0, false
+}
+
+// Determines the key and display name of a symbol; @local names are qualified by their scope.
+func (a *assembler) qualify(name string) (key, spelling string) {
+	if strings.HasPrefix(name, "@") {
+		name = a.scope + name
+	}
+	return strings.ToLower(name), name
+}
+
+// Evaluates an expression at the current address, reporting any error.
+func (a *assembler) evaluate(expression string) (int, bool) {
+	value, err := evaluate(expression, a.address(), a.resolve)
+	if err != nil {
+		a.errorf("%v", err)
+		return 0, false
+	}
+	return value, true
+}
+
+// Reports an error if the value lies outside of the given range.
+func (a *assembler) checkRange(value, min, max int, expression string) {
+	if value < min || value > max {
+		a.errorf("%s (%d) is out of range", expression, value)
+	}
+}
+
+// The address of the next byte to be emitted.
+func (a *assembler) address() int {
+	return a.origin + len(a.output)
+}
+
+// Moves any labels waiting on the next instruction or data to the current address.
+func (a *assembler) placeLabels() {
+	for _, symbol := range a.pending {
+		symbol.Value = a.address()
+	}
+	a.pending = nil
+}
+
+// Appends bytes to the output.
+func (a *assembler) emit(values ...byte) {
+	a.placeLabels()
+	a.output = append(a.output, values...)
+}
+
+// Records an error at the current line.
+func (a *assembler) errorf(format string, args ...interface{}) {
+	a.errors = append(a.errors, &Error{a.filename, a.line, fmt.Sprintf(format, args...)})
+}
+
+// Removes a trailing ; comment from a line.
+func stripComment(line string) string {
+	if pieces := splitOutsideQuotes(line, ';'); len(pieces) > 0 {
+		return pieces[0]
+	}
+	return line
+}
+
+// Splits text at each occurrence of the separator which isn't inside quotes or brackets.
+func splitOutsideQuotes(text string, separator byte) []string {
+	var pieces []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == separator && depth == 0:
+			pieces = append(pieces, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(pieces, text[start:])
+}
+
+// Returns the identifier at the start of the text, if any.
+func leadingIdentifier(text string) string {
+	if text == "" || !isIdentifierStart(text[0]) {
+		return ""
+	}
+	end := 1
+	for end < len(text) && isIdentifierPart(text[end]) {
+		end++
+	}
+	return text[:end]
+}
+
+// Determines if the word is a directive or mnemonic, rather than a label.
+func isKeyword(word string) bool {
+	switch word {
+	case "DB", ".BYTE", ".DB", "DW", ".WORD", ".DW", "DA", "ALIGN", "DEFINE", "UNDEF", "END",
+		"OPTION", "XREF", "USED", "IFDEF", "IFNDEF", "ELSE", "ENDIF", "EQU", "=":
+		return true
+	}
+	return isMnemonic(word)
+}
+
+// Determines if the word is an instruction mnemonic, or an alias of one.
+func isMnemonic(word string) bool {
+	_, instruction := instructions[word]
+	_, alias := aliases[word]
+	return instruction || alias
+}
@@ -0,0 +1,211 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package asm
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8/disasm"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// A bundled source, and the binary shipped alongside it.
+type BundledSource struct {
+	Source, Binary string
+	Trimmed        bool  // Whether the binary was shipped without the uninitialised data at its end.
+	Differences    []int // Offsets at which the binary was built from a different revision of the source.
+}
+
+var BundledSources = []BundledSource{
+	{Source: "GAMES/SOURCES/15PUZZLE.SRC", Binary: "GAMES/15PUZZLE"},
+	{Source: "GAMES/SOURCES/BLINKY.SRC", Binary: "GAMES/BLINKY"},
+	{Source: "GAMES/SOURCES/BREAKOUT.SRC", Binary: "GAMES/BREAKOUT"},
+	{Source: "GAMES/SOURCES/BRIX.SRC", Binary: "GAMES/BRIX"},
+	{Source: "GAMES/SOURCES/MAZE.SRC", Binary: "GAMES/MAZE"},
+	{Source: "GAMES/SOURCES/PONG.SRC", Binary: "GAMES/PONG"},
+	{Source: "GAMES/SOURCES/PONG2.SRC", Binary: "GAMES/PONG2"},
+	{Source: "GAMES/SOURCES/SYZYGY.SRC", Binary: "GAMES/SYZYGY"},
+	{Source: "GAMES/SOURCES/UFO.SRC", Binary: "GAMES/UFO"},
+	{Source: "BISQWIT/hello.src.txt", Binary: "BISQWIT/hello.bin"},
+	{Source: "BISQWIT/starfield.src.txt", Binary: "BISQWIT/starfield.bin"},
+
+	// the text filling hanoi's scratch variables was left out of the binary
+	{Source: "BISQWIT/hanoi.src.txt", Binary: "BISQWIT/hanoi.bin", Trimmed: true},
+
+	// the shipped VBRIX masks the ball's random starting row with #20, rather than #1E
+	{Source: "GAMES/SOURCES/VBRIX.SRC", Binary: "GAMES/VBRIX", Differences: []int{0xC1}},
+}
+
+// Asserts that each of the bundled sources assembles to its shipped binary.
+func TestBundledSources(t *testing.T) {
+	for _, bundled := range BundledSources {
+		source, err := ioutil.ReadFile(filepath.Join("../../programs", bundled.Source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := ioutil.ReadFile(filepath.Join("../../programs", bundled.Binary))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		program, err := Assemble(bundled.Source, source, 0x200)
+		if err != nil {
+			t.Errorf("%s failed to assemble:\n%v", bundled.Source, err)
+			continue
+		}
+
+		actual := program.Bytes
+		if bundled.Trimmed && len(actual) > len(expected) {
+			actual = actual[:len(expected)]
+		}
+		if len(actual) != len(expected) {
+			t.Errorf("%s assembled to %d bytes; expected %d", bundled.Source, len(actual), len(expected))
+			continue
+		}
+		known := make(map[int]bool)
+		for _, offset := range bundled.Differences {
+			known[offset] = true
+		}
+		for i := range actual {
+			if actual[i] != expected[i] && !known[i] {
+				t.Errorf("%s differs from %s at 0x%03X: #%02X; expected #%02X",
+					bundled.Source, bundled.Binary, program.Origin+uint16(i), actual[i], expected[i])
+				break
+			}
+		}
+	}
+}
+
+// Asserts that the disassembler's listings of the bundled games assemble back to the originals.
+func TestDisassemblyRoundTrip(t *testing.T) {
+	roms, err := filepath.Glob("../../programs/GAMES/[A-Z]*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rom := range roms {
+		original, err := ioutil.ReadFile(rom)
+		if err != nil {
+			continue // the SOURCES directory
+		}
+
+		// listings place data and code wherever the original did
+		var listing bytes.Buffer
+		listing.WriteString("ALIGN OFF\n")
+		disasm.Disassemble(original, 0x200).WriteTo(&listing)
+
+		program, err := Assemble(rom, listing.Bytes(), 0x200)
+		if err != nil {
+			t.Errorf("The listing of %s failed to assemble:\n%v", rom, err)
+		} else if !bytes.Equal(program.Bytes, original) {
+			t.Errorf("The listing of %s assembled to something else", rom)
+		}
+	}
+}
+
+// Expected values for a selection of expressions.
+var ExpressionTests = map[string]int{
+	"42":                  42,
+	"#2A":                 42,
+	"0x2a":                42,
+	"$101010":             42,
+	"$.1.1.1..":           0x54,
+	"0b00101010":          42,
+	"'*'":                 42,
+	"2 + 3 * 4":           14,
+	"(2 + 3) * 4":         20,
+	"1 < 4 | 1":           17,
+	"1 << 4 >> 2":         4,
+	"MAZEEND - MAZE \\ 4": 128,
+	"-1 & #FF":            0xFF,
+	"~#F0 & #FF":          0x0F,
+	"SHR(#1234, 8)":       0x12,
+	"AND(#1234, 255)":     0x34,
+	"? + 2":               0x302,
+	". - 2":               0x2FE,
+}
+
+// Asserts that expressions are evaluated with the expected precedence and syntax.
+func TestExpressions(t *testing.T) {
+	symbols := map[string]int{"MAZE": 0x400, "MAZEEND": 0x600}
+	resolve := func(name string) (int, bool) {
+		value, ok := symbols[name]
+		return value, ok
+	}
+	for expression, expected := range ExpressionTests {
+		actual, err := evaluate(expression, 0x300, resolve)
+		if err != nil {
+			t.Errorf("%s failed to evaluate: %v", expression, err)
+		} else if actual != expected {
+			t.Errorf("%s evaluated to 0x%X; expected 0x%X", expression, actual, expected)
+		}
+	}
+}
+
+// Asserts that the BISQWIT extensions assemble as expected.
+func TestBisqwitSyntax(t *testing.T) {
+	source := `
+start:	ld v0, 1 : ld v1, v0
+	@loop:	if v0 != 3 : add v0, 1
+	if v1 = v0 : jp @loop
+	ld [value], bcd v1
+	if key v2 : ret
+next:	@loop: jp @loop
+value:	.byte "ab", 0
+`
+	expected := []byte{
+		0x60, 0x01, // ld v0, 1
+		0x81, 0x00, // ld v1, v0
+		0x30, 0x03, // if v0 != 3
+		0x70, 0x01, // add v0, 1
+		0x91, 0x00, // if v1 = v0
+		0x12, 0x04, // jp start@loop
+		0xA2, 0x16, // ld [value], ...
+		0xF1, 0x33, // ... bcd v1
+		0xE2, 0xA1, // if key v2
+		0x00, 0xEE, // ret
+		0x12, 0x14, // jp next@loop
+		'a', 'b', 0,
+	}
+
+	program, err := Assemble("test.src", []byte(source), 0x200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(program.Bytes, expected) {
+		t.Errorf("Assembled to % X; expected % X", program.Bytes, expected)
+	}
+
+	var symbols bytes.Buffer
+	program.WriteSymbols(&symbols)
+	if expected := "0200 start\n0204 start@loop\n0214 next\n0214 next@loop\n0216 value\n"; symbols.String() != expected {
+		t.Errorf("Symbol map was\n%s\nexpected\n%s", symbols.String(), expected)
+	}
+}
+
+// Asserts that errors are reported against the lines they occur on.
+func TestErrors(t *testing.T) {
+	source := "    CLS\n    LD V0, MISSING\n    JP #1000\nA:  DB 1\nA:  FOO V1\n"
+	expected := []string{
+		"test.src:2: undefined symbol MISSING",
+		"test.src:3: #1000 (4096) is out of range",
+		"test.src:5: A is already defined on line 4",
+		"test.src:5: unknown instruction FOO",
+	}
+
+	_, err := Assemble("test.src", []byte(source), 0x200)
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Expected an ErrorList; got %v", err)
+	}
+	if len(list) != len(expected) {
+		t.Fatalf("Expected %d errors; got:\n%v", len(expected), err)
+	}
+	for i, message := range expected {
+		if list[i].Error() != message {
+			t.Errorf("Error %d was %q; expected %q", i, list[i].Error(), message)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resolves the value of a symbol, reporting false if it isn't (yet) defined.
+type resolver func(name string) (int, bool)
+
+// Evaluates arithmetic expressions over numbers and symbols.
+//
+// Numbers may be decimal (42), hexadecimal (0x2A or #2A) or binary (0b101010 or
+// $101010, where a '.' may stand in for a 0, for drawing sprites). The current address
+// is available as either '?' or '.'. Operators follow C's precedence, with '<'
+// and '>' accepted as shifts, and CHIPPER's '\' dividing after any addition or
+// subtraction. SHL(), SHR(), AND(), OR() and XOR() are available as functions.
+type evaluator struct {
+	input   string   // The expression being evaluated.
+	pos     int      // The position of the next unread character.
+	address int      // The address of the current statement.
+	resolve resolver // Resolves symbols to their values.
+}
+
+// Evaluates the given expression.
+func evaluate(input string, address int, resolve resolver) (int, error) {
+	e := &evaluator{input: input, address: address, resolve: resolve}
+	value, err := e.parseBinary(0)
+	if err != nil {
+		return 0, err
+	}
+	e.skipSpace()
+	if e.pos < len(e.input) {
+		return 0, fmt.Errorf("unexpected %q in expression %q", e.input[e.pos:], input)
+	}
+	return value, nil
+}
+
+// The binary operators, from the loosest binding to the tightest.
+var precedence = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>", "<", ">"},
+	{"\\"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// Parses a chain of binary operators at the given precedence level, or tighter.
+func (e *evaluator) parseBinary(level int) (int, error) {
+	if level == len(precedence) {
+		return e.parseUnary()
+	}
+	left, err := e.parseBinary(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		operator := e.peekOperator(precedence[level])
+		if operator == "" {
+			return left, nil
+		}
+		e.pos += len(operator)
+		right, err := e.parseBinary(level + 1)
+		if err != nil {
+			return 0, err
+		}
+		switch operator {
+		case "|":
+			left |= right
+		case "^":
+			left ^= right
+		case "&":
+			left &= right
+		case "<<", "<":
+			left <<= uint(right)
+		case ">>", ">":
+			left >>= uint(right)
+		case "+":
+			left += right
+		case "-":
+			left -= right
+		case "*":
+			left *= right
+		case "/", "\\", "%":
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero in expression %q", e.input)
+			}
+			if operator == "%" {
+				left %= right
+			} else {
+				left /= right
+			}
+		}
+	}
+}
+
+// Finds which of the given operators comes next, preferring the longest.
+func (e *evaluator) peekOperator(operators []string) string {
+	e.skipSpace()
+	found := ""
+	for _, operator := range operators {
+		if strings.HasPrefix(e.input[e.pos:], operator) && len(operator) > len(found) {
+			found = operator
+		}
+	}
+	// don't mistake the start of a longer operator for a shorter one
+	if len(found) == 1 && e.pos+1 < len(e.input) && (found == "<" || found == ">") {
+		if next := e.input[e.pos+1]; next == '<' || next == '>' {
+			return ""
+		}
+	}
+	return found
+}
+
+// Parses a unary operator and its operand, or a primary term.
+func (e *evaluator) parseUnary() (int, error) {
+	e.skipSpace()
+	if e.pos < len(e.input) {
+		switch e.input[e.pos] {
+		case '-':
+			e.pos++
+			value, err := e.parseUnary()
+			return -value, err
+		case '+':
+			e.pos++
+			return e.parseUnary()
+		case '~':
+			e.pos++
+			value, err := e.parseUnary()
+			return ^value, err
+		}
+	}
+	return e.parsePrimary()
+}
+
+// Parses a number, symbol, function call or parenthesised expression.
+func (e *evaluator) parsePrimary() (int, error) {
+	e.skipSpace()
+	if e.pos >= len(e.input) {
+		return 0, fmt.Errorf("expression %q ended unexpectedly", e.input)
+	}
+	c := e.input[e.pos]
+
+	switch {
+	case c == '(':
+		e.pos++
+		value, err := e.parseBinary(0)
+		if err != nil {
+			return 0, err
+		}
+		if !e.consume(')') {
+			return 0, fmt.Errorf("missing ) in expression %q", e.input)
+		}
+		return value, nil
+
+	case c == '?' || (c == '.' && !e.startsNumber(e.pos+1)):
+		e.pos++
+		return e.address, nil
+
+	case c == '#':
+		e.pos++
+		return e.parseDigits(16, "0123456789abcdefABCDEF")
+
+	case c == '$':
+		e.pos++
+		return e.parseDigits(2, "01.")
+
+	case c == '\'' || c == '"':
+		text, err := e.parseString()
+		if err != nil {
+			return 0, err
+		}
+		if len(text) != 1 {
+			return 0, fmt.Errorf("character constant %q must be a single character", text)
+		}
+		return int(text[0]), nil
+
+	case c >= '0' && c <= '9':
+		rest := strings.ToLower(e.input[e.pos:])
+		if strings.HasPrefix(rest, "0x") {
+			e.pos += 2
+			return e.parseDigits(16, "0123456789abcdefABCDEF")
+		}
+		if strings.HasPrefix(rest, "0b") {
+			e.pos += 2
+			return e.parseDigits(2, "01")
+		}
+		return e.parseDigits(10, "0123456789")
+
+	case isIdentifierStart(c):
+		name := e.parseIdentifier()
+		e.skipSpace()
+		if e.pos < len(e.input) && e.input[e.pos] == '(' {
+			return e.parseCall(name)
+		}
+		value, ok := e.resolve(name)
+		if !ok {
+			return 0, &undefinedError{name}
+		}
+		return value, nil
+	}
+
+	return 0, fmt.Errorf("unexpected %q in expression %q", e.input[e.pos:], e.input)
+}
+
+// Parses the arguments to one of the built-in functions, and applies it.
+func (e *evaluator) parseCall(name string) (int, error) {
+	e.pos++ // the opening parenthesis
+	var args []int
+	for {
+		value, err := e.parseBinary(0)
+		if err != nil {
+			return 0, err
+		}
+		args = append(args, value)
+		if e.consume(')') {
+			break
+		}
+		if !e.consume(',') {
+			return 0, fmt.Errorf("expected , or ) in call to %s", name)
+		}
+	}
+	if len(args) != 2 {
+		return 0, fmt.Errorf("%s expects 2 arguments, got %d", name, len(args))
+	}
+	switch strings.ToUpper(name) {
+	case "SHL":
+		return args[0] << uint(args[1]), nil
+	case "SHR":
+		return args[0] >> uint(args[1]), nil
+	case "AND":
+		return args[0] & args[1], nil
+	case "OR":
+		return args[0] | args[1], nil
+	case "XOR":
+		return args[0] ^ args[1], nil
+	}
+	return 0, fmt.Errorf("unknown function %s", name)
+}
+
+// Parses a run of digits in the given base; '.' is taken as a binary 0.
+func (e *evaluator) parseDigits(base int, digits string) (int, error) {
+	start := e.pos
+	for e.pos < len(e.input) && strings.IndexByte(digits, e.input[e.pos]) >= 0 {
+		e.pos++
+	}
+	text := strings.Replace(e.input[start:e.pos], ".", "0", -1)
+	if text == "" {
+		return 0, fmt.Errorf("malformed number in expression %q", e.input)
+	}
+	value, err := strconv.ParseInt(text, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed number %q", text)
+	}
+	return int(value), nil
+}
+
+// Parses a quoted string; the quote character may be doubled to include it.
+func (e *evaluator) parseString() (string, error) {
+	text, n, err := parseString(e.input[e.pos:])
+	e.pos += n
+	return text, err
+}
+
+// Parses an identifier.
+func (e *evaluator) parseIdentifier() string {
+	start := e.pos
+	for e.pos < len(e.input) && isIdentifierPart(e.input[e.pos]) {
+		e.pos++
+	}
+	return e.input[start:e.pos]
+}
+
+// Consumes the given character, if it's next.
+func (e *evaluator) consume(c byte) bool {
+	e.skipSpace()
+	if e.pos < len(e.input) && e.input[e.pos] == c {
+		e.pos++
+		return true
+	}
+	return false
+}
+
+// Determines if a number starts at the given position.
+func (e *evaluator) startsNumber(pos int) bool {
+	return pos < len(e.input) && e.input[pos] >= '0' && e.input[pos] <= '9'
+}
+
+// Skips any whitespace.
+func (e *evaluator) skipSpace() {
+	for e.pos < len(e.input) && (e.input[e.pos] == ' ' || e.input[e.pos] == '\t') {
+		e.pos++
+	}
+}
+
+// Parses a string quoted with either ' or "; the quote may be doubled to include it.
+// Returns the string and the number of characters consumed.
+func parseString(input string) (string, int, error) {
+	quote := input[0]
+	var text []byte
+	for i := 1; i < len(input); i++ {
+		if input[i] != quote {
+			text = append(text, input[i])
+			continue
+		}
+		if i+1 < len(input) && input[i+1] == quote {
+			text = append(text, quote)
+			i++
+			continue
+		}
+		return string(text), i + 1, nil
+	}
+	return "", len(input), fmt.Errorf("unterminated string %s", input)
+}
+
+// Determines if the given character may start an identifier.
+func isIdentifierStart(c byte) bool {
+	return c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Determines if the given character may continue an identifier.
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
+
+// Raised when an expression refers to a symbol that hasn't been defined.
+type undefinedError struct {
+	name string
+}
+
+func (err *undefinedError) Error() string {
+	return fmt.Sprintf("undefined symbol %s", err.name)
+}
@@ -0,0 +1,332 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package asm
+
+import "strings"
+
+// One of the operand combinations accepted by a mnemonic.
+//
+// Each operand pattern is either a keyword which must appear verbatim (I, DT,
+// [I] and so on), or one of:
+//
+//	V       a register, placed in the x nibble, or the y nibble if x is taken
+//	V-V     a range of registers, placed in the x and y nibbles
+//	V0-V    a range of registers starting at V0, with the last placed in the x nibble
+//	BYTE    an 8-bit value
+//	NIBBLE  a 4-bit value
+//	ADDR    a 12-bit address
+//	[ADDR]  an address, loaded into I by an extra instruction beforehand
+//	BCD V   a register, as in BISQWIT's LD [ADDR], BCD V
+type form struct {
+	operands []string // The operand patterns.
+	opcode   uint16   // The opcode, before the operands are inserted.
+}
+
+// The operand combinations accepted by each mnemonic.
+var instructions = map[string][]form{
+	"CLS":  {{nil, 0x00E0}},
+	"RET":  {{nil, 0x00EE}},
+	"SCD":  {{[]string{"NIBBLE"}, 0x00C0}},
+	"SCU":  {{[]string{"NIBBLE"}, 0x00D0}},
+	"SCR":  {{nil, 0x00FB}},
+	"SCL":  {{nil, 0x00FC}},
+	"EXIT": {{nil, 0x00FD}},
+	"LOW":  {{nil, 0x00FE}},
+	"HIGH": {{nil, 0x00FF}},
+	"SYS":  {{[]string{"ADDR"}, 0x0000}},
+	"JP": {
+		{[]string{"ADDR"}, 0x1000},
+		{[]string{"V0", "ADDR"}, 0xB000},
+	},
+	"CALL": {{[]string{"ADDR"}, 0x2000}},
+	"SE": {
+		{[]string{"V", "V"}, 0x5000},
+		{[]string{"V", "BYTE"}, 0x3000},
+	},
+	"SNE": {
+		{[]string{"V", "V"}, 0x9000},
+		{[]string{"V", "BYTE"}, 0x4000},
+	},
+	"SAVE": {{[]string{"V-V"}, 0x5002}},
+	"LOAD": {{[]string{"V-V"}, 0x5003}},
+	"LD": {
+		{[]string{"V", "V"}, 0x8000},
+		{[]string{"V", "DT"}, 0xF007},
+		{[]string{"V", "K"}, 0xF00A},
+		{[]string{"V", "[I]"}, 0xF065},
+		{[]string{"V", "R"}, 0xF085},
+		{[]string{"V", "[ADDR]"}, 0xF065},
+		{[]string{"V", "BYTE"}, 0x6000},
+		{[]string{"I", "ADDR"}, 0xA000},
+		{[]string{"DT", "V"}, 0xF015},
+		{[]string{"ST", "V"}, 0xF018},
+		{[]string{"F", "V"}, 0xF029},
+		{[]string{"HF", "V"}, 0xF030},
+		{[]string{"B", "V"}, 0xF033},
+		{[]string{"[I]", "V"}, 0xF055},
+		{[]string{"R", "V"}, 0xF075},
+		{[]string{"[ADDR]", "V"}, 0xF055},
+		{[]string{"[ADDR]", "BCD V"}, 0xF033},
+	},
+	"ADD": {
+		{[]string{"V", "V"}, 0x8004},
+		{[]string{"I", "V"}, 0xF01E},
+		{[]string{"V", "BYTE"}, 0x7000},
+	},
+	"OR":   {{[]string{"V", "V"}, 0x8001}},
+	"AND":  {{[]string{"V", "V"}, 0x8002}},
+	"XOR":  {{[]string{"V", "V"}, 0x8003}},
+	"SUB":  {{[]string{"V", "V"}, 0x8005}},
+	"SUBN": {{[]string{"V", "V"}, 0x8007}},
+	"SHR": {
+		{[]string{"V"}, 0x8006},
+		{[]string{"V", "V"}, 0x8006},
+	},
+	"SHL": {
+		{[]string{"V"}, 0x800E},
+		{[]string{"V", "V"}, 0x800E},
+	},
+	"RND":   {{[]string{"V", "BYTE"}, 0xC000}},
+	"DRW":   {{[]string{"V", "V", "NIBBLE"}, 0xD000}},
+	"SKP":   {{[]string{"V"}, 0xE09E}},
+	"SKNP":  {{[]string{"V"}, 0xE0A1}},
+	"PLANE": {{[]string{"NIBBLE"}, 0xF001}},
+	"AUDIO": {{nil, 0xF002}},
+	"PITCH": {{[]string{"V"}, 0xF03A}},
+
+	// mnemonics of Paul Robson's assembler with no direct CHIPPER equivalent
+	"GDELAY": {{[]string{"V"}, 0xF007}},
+	"KEY":    {{[]string{"V"}, 0xF00A}},
+	"LDR":    {{[]string{"V0-V"}, 0xF065}},
+	"STR":    {{[]string{"V0-V"}, 0xF055}},
+}
+
+// Mnemonics of Paul Robson's assembler, as used by VBRIX, and their CHIPPER equivalents.
+var aliases = map[string]struct {
+	mnemonic string   // The CHIPPER mnemonic.
+	prefix   []string // Operands implied by the alias, inserted before those given.
+}{
+	"MOV":    {"LD", nil},
+	"MVI":    {"LD", []string{"I"}},
+	"JMP":    {"JP", nil},
+	"JSR":    {"CALL", nil},
+	"RTS":    {"RET", nil},
+	"SKEQ":   {"SE", nil},
+	"SKNE":   {"SNE", nil},
+	"SKPR":   {"SKP", nil},
+	"SKUP":   {"SKNP", nil},
+	"RSB":    {"SUBN", nil},
+	"RANDOM": {"RND", nil},
+	"SPRITE": {"DRW", nil},
+	"HALT":   {"EXIT", nil},
+	"ADI":    {"ADD", []string{"I"}},
+	"SDELAY": {"LD", []string{"DT"}},
+	"SSOUND": {"LD", []string{"ST"}},
+	"FONT":   {"LD", []string{"F"}},
+	"XFONT":  {"LD", []string{"HF"}},
+	"BCD":    {"LD", []string{"B"}},
+}
+
+// Assembles an instruction, choosing the first form which matches its operands.
+func (a *assembler) instruction(mnemonic string, text string) {
+	var operands []string
+	if strings.TrimSpace(text) != "" {
+		for _, operand := range splitOutsideQuotes(text, ',') {
+			operands = append(operands, strings.TrimSpace(operand))
+		}
+	}
+	if alias, ok := aliases[mnemonic]; ok {
+		mnemonic = alias.mnemonic
+		operands = append(append([]string(nil), alias.prefix...), operands...)
+	}
+
+	for _, form := range instructions[mnemonic] {
+		if !form.matches(operands) {
+			continue
+		}
+		// instructions following data are aligned to even addresses, unless ALIGN OFF is given
+		if a.align && !a.unpadded && a.address()%2 == 1 {
+			a.output = append(a.output, 0)
+		}
+		for _, word := range a.encode(form, operands) {
+			a.emit(byte(word>>8), byte(word))
+		}
+		return
+	}
+	a.errorf("invalid operands for %s: %s", mnemonic, strings.Join(operands, ", "))
+}
+
+// Determines if the operands fit the form; expressions aren't evaluated yet.
+func (f form) matches(operands []string) bool {
+	if len(operands) != len(f.operands) {
+		return false
+	}
+	for i, pattern := range f.operands {
+		operand := operands[i]
+		switch pattern {
+		case "V":
+			if _, ok := register(operand); !ok {
+				return false
+			}
+		case "V0":
+			if x, ok := register(operand); !ok || x != 0 {
+				return false
+			}
+		case "V-V":
+			if _, _, ok := registerRange(operand); !ok {
+				return false
+			}
+		case "V0-V":
+			if x, _, ok := registerRange(operand); !ok || x != 0 {
+				return false
+			}
+		case "BYTE", "NIBBLE", "ADDR":
+			if !isExpression(operand) {
+				return false
+			}
+		case "[ADDR]":
+			if !isBracketed(operand) || strings.EqualFold(operand, "[I]") {
+				return false
+			}
+		case "BCD V":
+			fields := strings.Fields(operand)
+			if len(fields) != 2 || !strings.EqualFold(fields[0], "BCD") {
+				return false
+			}
+			if _, ok := register(fields[1]); !ok {
+				return false
+			}
+		default:
+			if !strings.EqualFold(operand, pattern) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Encodes the operands into the form's opcode, along with the Annn which precedes an [ADDR] form.
+func (a *assembler) encode(f form, operands []string) []uint16 {
+	opcode := f.opcode
+	var prefix []uint16
+	registers := 0
+
+	// places a register in the x nibble, or the y nibble if x is taken
+	place := func(r byte) {
+		if registers == 0 {
+			opcode |= uint16(r) << 8
+		} else {
+			opcode |= uint16(r) << 4
+		}
+		registers++
+	}
+
+	for i, pattern := range f.operands {
+		operand := operands[i]
+		switch pattern {
+		case "V":
+			r, _ := register(operand)
+			place(r)
+		case "V-V":
+			x, y, _ := registerRange(operand)
+			place(x)
+			place(y)
+		case "V0-V":
+			_, y, _ := registerRange(operand)
+			place(y)
+		case "BCD V":
+			r, _ := register(strings.Fields(operand)[1])
+			place(r)
+		case "BYTE":
+			opcode |= uint16(a.operand(operand, -128, 0xFF) & 0xFF)
+		case "NIBBLE":
+			opcode |= uint16(a.operand(operand, 0, 0xF))
+		case "ADDR":
+			opcode |= uint16(a.operand(operand, 0, 0xFFF))
+		case "[ADDR]":
+			address := a.operand(operand[1:len(operand)-1], 0, 0xFFF)
+			prefix = append(prefix, 0xA000|uint16(address))
+		}
+	}
+	return append(prefix, opcode)
+}
+
+// Evaluates an operand, reporting an error if it lies outside the given range.
+func (a *assembler) operand(expression string, min, max int) int {
+	value, ok := a.evaluate(expression)
+	if ok {
+		a.checkRange(value, min, max, expression)
+	}
+	return value & max
+}
+
+// Assembles the skip for a BISQWIT 'if condition : statement'.
+// The skip is the inverse of the condition, so the statement runs only if it holds.
+func (a *assembler) condition(text string) {
+	fields := strings.Fields(text)
+	if len(fields) == 2 && strings.EqualFold(fields[0], "key") {
+		a.instruction("SKNP", fields[1])
+		return
+	}
+
+	for _, operator := range []string{"!=", "<>", "==", "="} {
+		index := strings.Index(text, operator)
+		if index < 0 {
+			continue
+		}
+		left := strings.TrimSpace(text[:index])
+		right := strings.TrimSpace(text[index+len(operator):])
+		mnemonic := "SNE"
+		if operator == "!=" || operator == "<>" {
+			mnemonic = "SE"
+		}
+		a.instruction(mnemonic, left+", "+right)
+		return
+	}
+	a.errorf("invalid condition %s", text)
+}
+
+// Parses a register name, V0 to VF; R0 to RF are accepted as synonyms.
+func register(text string) (byte, bool) {
+	if len(text) != 2 || strings.IndexByte("VvRr", text[0]) < 0 {
+		return 0, false
+	}
+	index := strings.IndexByte("0123456789ABCDEF", strings.ToUpper(text)[1])
+	if index < 0 {
+		return 0, false
+	}
+	return byte(index), true
+}
+
+// Parses a range of registers, e.g. V0 - V3.
+func registerRange(text string) (byte, byte, bool) {
+	pieces := strings.Split(text, "-")
+	if len(pieces) != 2 {
+		return 0, 0, false
+	}
+	x, ok := register(strings.TrimSpace(pieces[0]))
+	if !ok {
+		return 0, 0, false
+	}
+	y, ok := register(strings.TrimSpace(pieces[1]))
+	return x, y, ok
+}
+
+// Determines if an operand is an expression, rather than a register or keyword.
+func isExpression(text string) bool {
+	if _, ok := register(text); ok || text == "" || isBracketed(text) {
+		return false
+	}
+	switch strings.ToUpper(text) {
+	case "I", "DT", "ST", "K", "F", "HF", "B", "R":
+		return false
+	}
+	return true
+}
+
+// Determines if an operand is wrapped in square brackets.
+func isBracketed(text string) bool {
+	return strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]")
+}
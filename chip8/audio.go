@@ -0,0 +1,179 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// The rate at which audio is synthesized, in samples per second.
+const SampleRate = 44100
+
+// The number of samples synthesized for each 60hz frame.
+const SamplesPerFrame = SampleRate / FrameRate
+
+// The value of a silent 8-bit unsigned sample.
+const silentSample = 0x80
+
+// The sound played during a single 60hz frame.
+type Sound struct {
+	Playing bool     // Whether the sound timer is active; the frame is silent otherwise.
+	Pattern [16]byte // The XO-CHIP audio pattern; zeroed unless the program loaded one.
+	Pitch   byte     // The XO-CHIP playback rate of the pattern.
+}
+
+// Receives the sound produced by the CPU, a frame at a time.
+// The CPU feeds its sink on each tick of the timers; a tone whilst ST > 0, and
+// silence otherwise, so that the sink may keep time with the emulation.
+type AudioSink interface {
+	PlayFrame(sound Sound) // Plays a single 60hz frame of sound.
+}
+
+// An audio sink which discards everything; for running without a sound card.
+type NullSink struct{}
+
+// Discards the frame.
+func (NullSink) PlayFrame(sound Sound) {}
+
+// Synthesizes the samples of each frame as 8-bit unsigned mono PCM.
+//
+// Programs play a square wave of the configured frequency, unless they loaded an
+// XO-CHIP audio pattern, which is played as a 1-bit waveform at the rate given by
+// the pitch register instead.
+type Synthesizer struct {
+	Frequency float64 // The frequency of the square wave, in hertz.
+	Volume    float64 // The volume, from 0 for silence to 1 for full scale.
+	phase     float64 // The progress through the current cycle of the waveform, from 0 to 1.
+}
+
+// Builds a new synthesizer of the given square wave frequency and volume.
+func NewSynthesizer(frequency, volume float64) *Synthesizer {
+	return &Synthesizer{Frequency: frequency, Volume: volume}
+}
+
+// Appends a frame of samples for the given sound to the buffer.
+func (synth *Synthesizer) Synthesize(buffer []byte, sound Sound) []byte {
+	if !sound.Playing {
+		// start the next tone from the beginning of its cycle
+		synth.phase = 0
+		for i := 0; i < SamplesPerFrame; i++ {
+			buffer = append(buffer, silentSample)
+		}
+		return buffer
+	}
+
+	amplitude := math.Max(0, math.Min(1, synth.Volume)) * 127
+	high, low := byte(silentSample+amplitude), byte(silentSample-amplitude)
+	pattern := sound.Pattern != [16]byte{}
+
+	// a pattern cycles through its 128 samples, a square wave through a single period
+	step := synth.Frequency / SampleRate
+	if pattern {
+		step = 4000 * math.Pow(2, (float64(sound.Pitch)-64)/48) / SampleRate / 128
+	}
+	for i := 0; i < SamplesPerFrame; i++ {
+		var on bool
+		if pattern {
+			bit := int(synth.phase * 128)
+			on = sound.Pattern[bit/8]&(0x80>>uint(bit%8)) != 0
+		} else {
+			on = synth.phase < 0.5
+		}
+		if on {
+			buffer = append(buffer, high)
+		} else {
+			buffer = append(buffer, low)
+		}
+		synth.phase += step
+		synth.phase -= math.Floor(synth.phase)
+	}
+	return buffer
+}
+
+// The size of a canonical WAV file's header, in bytes.
+const wavHeaderSize = 44
+
+// An audio sink which writes everything played to a WAV file; including
+// silence, so that the file keeps time with the emulation.
+type WAVSink struct {
+	writer  io.WriteSeeker // The file being written.
+	synth   *Synthesizer   // The synthesizer of the samples.
+	buffer  []byte         // The samples of the current frame; reused between frames.
+	samples uint32         // The number of samples written so far.
+	err     error          // The first error encountered, if any.
+}
+
+// Builds a new sink writing to the given file; which must be closed to complete it.
+func NewWAVSink(writer io.WriteSeeker, synth *Synthesizer) (*WAVSink, error) {
+	sink := &WAVSink{writer: writer, synth: synth}
+	// write a placeholder header; the sizes are filled in on closing
+	if err := sink.writeHeader(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// Appends the frame's samples to the file.
+// Errors are deferred until the sink is closed.
+func (sink *WAVSink) PlayFrame(sound Sound) {
+	if sink.err != nil {
+		return
+	}
+	sink.buffer = sink.synth.Synthesize(sink.buffer[:0], sound)
+	_, sink.err = sink.writer.Write(sink.buffer)
+	sink.samples += uint32(len(sink.buffer))
+}
+
+// Completes the file's header; the file itself is left open.
+// Returns the first error encountered whilst writing the file, if any.
+func (sink *WAVSink) Close() error {
+	if sink.err != nil {
+		return sink.err
+	}
+	if _, err := sink.writer.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := sink.writeHeader(); err != nil {
+		return err
+	}
+	_, err := sink.writer.Seek(0, io.SeekEnd)
+	return err
+}
+
+// Writes the header of a mono 8-bit PCM file holding the samples written so far.
+func (sink *WAVSink) writeHeader() error {
+	header := struct {
+		Riff          [4]byte
+		RiffSize      uint32
+		Wave          [4]byte
+		Format        [4]byte
+		FormatSize    uint32
+		AudioFormat   uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		Riff:          [4]byte{'R', 'I', 'F', 'F'},
+		RiffSize:      wavHeaderSize - 8 + sink.samples,
+		Wave:          [4]byte{'W', 'A', 'V', 'E'},
+		Format:        [4]byte{'f', 'm', 't', ' '},
+		FormatSize:    16,
+		AudioFormat:   1, // uncompressed PCM
+		Channels:      1,
+		SampleRate:    SampleRate,
+		ByteRate:      SampleRate,
+		BlockAlign:    1,
+		BitsPerSample: 8,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      sink.samples,
+	}
+	return binary.Write(sink.writer, binary.LittleEndian, &header)
+}
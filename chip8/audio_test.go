@@ -0,0 +1,100 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Asserts the samples synthesized for a frame of each kind of sound.
+func TestSynthesizer(t *testing.T) {
+	pattern := [16]byte{0xFF}
+	tests := map[string]struct {
+		Sound    Sound
+		Expected map[int]byte // The expected value of samples, by index.
+	}{
+		"silence": {
+			Sound:    Sound{},
+			Expected: map[int]byte{0: 0x80, 25: 0x80, 734: 0x80},
+		},
+		"square wave": {
+			// 441hz is a period of 100 samples
+			Sound:    Sound{Playing: true},
+			Expected: map[int]byte{0: 0xFF, 49: 0xFF, 50: 0x01, 99: 0x01, 100: 0xFF},
+		},
+		"pattern": {
+			// 4000hz plays each bit of the pattern for just over 11 samples
+			Sound:    Sound{Playing: true, Pattern: pattern, Pitch: 64},
+			Expected: map[int]byte{0: 0xFF, 88: 0xFF, 89: 0x01, 1410: 0x01, 1412: 0xFF},
+		},
+	}
+
+	for name, test := range tests {
+		synth := NewSynthesizer(441, 1)
+		// synthesize a couple of frames, to check the waveform continues across frames
+		samples := synth.Synthesize(nil, test.Sound)
+		samples = synth.Synthesize(samples, test.Sound)
+		assertEquals(t, name+" samples", len(samples), 2*SamplesPerFrame)
+		for index, expected := range test.Expected {
+			if samples[index] != expected {
+				t.Errorf("%s: sample %d was %02X; expected %02X", name, index, samples[index], expected)
+			}
+		}
+	}
+}
+
+// Asserts the sound timer plays a tone for as many frames as it was set to,
+// followed by silence, by recording it to a WAV file.
+func TestWAVSink(t *testing.T) {
+	file, err := ioutil.TempFile("", "chip8-audio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	sink, err := NewWAVSink(file, NewSynthesizer(441, 0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cpu := NewCPU()
+	cpu.Audio = sink
+	cpu.LoadProgram([]byte{
+		0x60, 0x1E, // 200: LD V0, 30
+		0xF0, 0x18, // 202: LD ST, V0
+		0x12, 0x04, // 204: JP 204
+	})
+	if _, err := cpu.RunFrames(60, 10, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "length", len(contents), wavHeaderSize+60*SamplesPerFrame)
+	assertEquals(t, "RIFF", string(contents[0:4]) == "RIFF", true)
+	assertEquals(t, "RIFF size", binary.LittleEndian.Uint32(contents[4:]), uint32(len(contents)-8))
+	assertEquals(t, "sample rate", binary.LittleEndian.Uint32(contents[24:]), SampleRate)
+	assertEquals(t, "data size", binary.LittleEndian.Uint32(contents[40:]), 60*SamplesPerFrame)
+
+	// count the frames which made a sound
+	samples := contents[wavHeaderSize:]
+	for frame := 0; frame < 60; frame++ {
+		audible := false
+		for _, sample := range samples[frame*SamplesPerFrame : (frame+1)*SamplesPerFrame] {
+			audible = audible || sample != 0x80
+		}
+		if audible != (frame < 30) {
+			t.Errorf("Frame %d was audible: %v; expected %v", frame, audible, frame < 30)
+		}
+	}
+}
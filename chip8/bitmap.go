@@ -0,0 +1,201 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+)
+
+const (
+	Width       = 64  // Display width, in pixels.
+	Height      = 32  // Display height, in pixels.
+	HiResWidth  = 128 // Display width in SUPER-CHIP high resolution mode, in pixels.
+	HiResHeight = 64  // Display height in SUPER-CHIP high resolution mode, in pixels.
+	AllPlanes   = 0x3 // A mask of both XO-CHIP bitplanes.
+)
+
+// The colours used for each pixel value; that is, each combination of lit bitplanes.
+var Palette = [4]color.RGBA{
+	{R: 0, G: 0, B: 0, A: 255},       // no planes
+	{R: 255, G: 255, B: 255, A: 255}, // plane 1
+	{R: 170, G: 170, B: 170, A: 255}, // plane 2
+	{R: 85, G: 85, B: 85, A: 255},    // both planes
+}
+
+// The characters used for each pixel value when drawing the bitmap as text.
+const asciiPalette = ".#+@"
+
+// Represents a bitmap of pixels as used in our Chip 8 implementation.
+// 64 * 32 pixels (2048 total pixels) in the default low resolution mode, or
+// 128 * 64 pixels (8192 total pixels) in the SUPER-CHIP high resolution mode.
+// The origin (0, 0) is in the top left.
+//
+// Each pixel value is a mask of the XO-CHIP bitplanes that are lit at that
+// location; plane 1 is bit 0 and plane 2 is bit 1, giving up to 4 colours.
+// Programs which never select plane 2 only produce values of 0 and 1.
+type Bitmap struct {
+	pixels [HiResWidth * HiResHeight]byte // Pixel values, in rows of the current width.
+	hiRes  bool                           // Whether the high resolution mode is enabled.
+}
+
+// The width of the bitmap at the current resolution, in pixels.
+func (bitmap *Bitmap) Width() int {
+	if bitmap.hiRes {
+		return HiResWidth
+	}
+	return Width
+}
+
+// The height of the bitmap at the current resolution, in pixels.
+func (bitmap *Bitmap) Height() int {
+	if bitmap.hiRes {
+		return HiResHeight
+	}
+	return Height
+}
+
+// Determines if the bitmap is in the high resolution mode.
+func (bitmap *Bitmap) IsHiRes() bool {
+	return bitmap.hiRes
+}
+
+// Retrieves the pixel value at the given (x, y) coordinates.
+func (bitmap *Bitmap) GetPixel(x, y int) byte {
+	return bitmap.pixels[x+y*bitmap.Width()]
+}
+
+// Empties the bitmap's content on the given planes.
+func (bitmap *Bitmap) clear(planes byte) {
+	for i := range bitmap.pixels {
+		bitmap.pixels[i] &^= planes
+	}
+}
+
+// Switches between the low and high resolution modes, clearing the bitmap.
+func (bitmap *Bitmap) setHiRes(hiRes bool) {
+	bitmap.hiRes = hiRes
+	bitmap.clear(AllPlanes)
+}
+
+// Writes a sprite at the given (x, y) coordinates.
+// A sprite is a collection of bits representing pixel values over a range,
+// with each row being the given number of columns (8 or 16) wide.
+// The origin wraps around the display; the remainder of the sprite is either
+// clipped at the edges of the display, or wrapped around to the other side.
+// The sprite is drawn onto the given plane only.
+// Returns a flag indicating if an existing pixel was overwritten.
+func (bitmap *Bitmap) writeSprite(sprite []byte, columns int, x, y byte, plane byte, clip bool) (collided bool) {
+	width, height := bitmap.Width(), bitmap.Height()
+	stride := columns / 8
+	n := len(sprite) / stride
+
+	for yl := 0; yl < n; yl++ {
+		ypos := int(y)%height + yl
+		if ypos >= height {
+			if clip {
+				break
+			}
+			ypos = ypos - height
+		}
+
+		for xl := 0; xl < columns; xl++ {
+			r := sprite[yl*stride+xl/8]
+			i := byte(0x80 >> byte(xl%8))
+			if r&i == 0 {
+				continue // pixel not set in the sprite
+			}
+
+			xpos := int(x)%width + xl
+			if xpos >= width {
+				if clip {
+					break
+				}
+				xpos = xpos - width
+			}
+
+			if bitmap.pixels[xpos+ypos*width]&plane != 0 {
+				collided = true // collision detected
+			}
+
+			bitmap.pixels[xpos+ypos*width] ^= plane
+		}
+	}
+	return
+}
+
+// Scrolls the bitmap's content on the given planes by the given number of pixels.
+// Positive values scroll right or down, negative values scroll left or up.
+func (bitmap *Bitmap) scroll(planes byte, dx, dy int) {
+	width, height := bitmap.Width(), bitmap.Height()
+
+	// samples the pixel that will move into (x, y)
+	source := func(x, y int) byte {
+		x, y = x-dx, y-dy
+		if x < 0 || x >= width || y < 0 || y >= height {
+			return 0
+		}
+		return bitmap.pixels[x+y*width] & planes
+	}
+
+	// walk against the direction of travel, so sources are read before they're overwritten
+	for yi := 0; yi < height; yi++ {
+		y := yi
+		if dy > 0 {
+			y = height - 1 - yi
+		}
+		for xi := 0; xi < width; xi++ {
+			x := xi
+			if dx > 0 {
+				x = width - 1 - xi
+			}
+			i := x + y*width
+			bitmap.pixels[i] = bitmap.pixels[i]&^planes | source(x, y)
+		}
+	}
+}
+
+// Renders the bitmap as an image in the default palette, with each pixel
+// scaled up to a square of the given size.
+func (bitmap *Bitmap) Image(scale int) *image.Paletted {
+	return bitmap.PaletteImage(scale, Palette)
+}
+
+// Renders the bitmap as an image in the given palette, with each pixel scaled
+// up to a square of the given size.
+func (bitmap *Bitmap) PaletteImage(scale int, colours [4]color.RGBA) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	width, height := bitmap.Width(), bitmap.Height()
+	palette := make(color.Palette, len(colours))
+	for i, colour := range colours {
+		palette[i] = colour
+	}
+
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), palette)
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			img.SetColorIndex(x, y, bitmap.GetPixel(x/scale, y/scale)&AllPlanes)
+		}
+	}
+	return img
+}
+
+// Renders the bitmap as text, a line per row; unlit pixels are drawn as '.',
+// plane 1 as '#', plane 2 as '+' and both planes as '@'.
+func (bitmap *Bitmap) String() string {
+	width, height := bitmap.Width(), bitmap.Height()
+	var text bytes.Buffer
+	text.Grow((width + 1) * height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			text.WriteByte(asciiPalette[bitmap.GetPixel(x, y)&AllPlanes])
+		}
+		text.WriteByte('\n')
+	}
+	return text.String()
+}
@@ -0,0 +1,33 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"strings"
+	"testing"
+)
+
+// Asserts that the bitmap renders to text and images pixel for pixel.
+func TestBitmapRendering(t *testing.T) {
+	var bitmap Bitmap
+	bitmap.writeSprite([]byte{0xA0}, 8, 0, 0, 1, true)
+	bitmap.writeSprite([]byte{0x60}, 8, 0, 0, 2, true)
+
+	lines := strings.Split(bitmap.String(), "\n")
+	assertEquals(t, "lines", len(lines), Height+1)
+	if !strings.HasPrefix(lines[0], "#+@.") || len(lines[0]) != Width {
+		t.Errorf("First row rendered as %q", lines[0])
+	}
+	if lines[1] != strings.Repeat(".", Width) {
+		t.Errorf("Second row rendered as %q", lines[1])
+	}
+
+	img := bitmap.Image(2)
+	assertEquals(t, "width", img.Rect.Dx(), Width*2)
+	assertEquals(t, "height", img.Rect.Dy(), Height*2)
+	for x, expected := range []byte{1, 1, 2, 2, 3, 3, 0, 0} {
+		assertEquals(t, "pixel", img.ColorIndexAt(x, 1), expected)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// A display which records the frames presented to it as a video, one frame
+// per 60hz tick, to be shared in bug reports and the like.
+//
+// Videos are of a fixed size, which fits the SUPER-CHIP high resolution mode
+// at the chosen scale; low resolution frames are drawn at twice the scale, so
+// programs switching resolution keep the same picture size throughout.
+type Capture interface {
+	Display
+	Close() error // Completes the video; the underlying writer is left open.
+}
+
+// Builds a capture in the format given by the filename's extension; .gif for
+// an animated GIF, or .y4m for an uncompressed YUV4MPEG2 video.
+func NewCapture(filename string, writer io.Writer, scale int) (Capture, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gif":
+		return NewGIFCapture(writer, scale), nil
+	case ".y4m":
+		return NewY4MCapture(writer, scale), nil
+	}
+	return nil, fmt.Errorf("unsupported capture format %s; expected .gif or .y4m", filename)
+}
+
+// The fixed size of a captured video, and the scale of the current resolution's pixels within it.
+type canvas struct {
+	width, height int // The size of the video, in pixels.
+	scale         int // The size of each of the current resolution's pixels.
+}
+
+// Builds a canvas fitting the high resolution mode at the given scale.
+func newCanvas(scale int) canvas {
+	if scale < 1 {
+		scale = 1
+	}
+	return canvas{width: HiResWidth * scale, height: HiResHeight * scale, scale: scale}
+}
+
+// Scales the frames of the given resolution to fill the canvas.
+func (canvas *canvas) resize(width, height int) {
+	canvas.scale = canvas.width / width
+}
+
+// Records frames into an animated GIF, which is written on closing.
+// Runs of identical frames are merged into a single, longer frame, and frames
+// are held as bitmaps until then, rather than as images at the GIF's size.
+type GIFCapture struct {
+	writer  io.Writer     // The destination of the GIF.
+	canvas  canvas        // The size of the GIF.
+	palette [4]color.RGBA // The colours of each pixel value.
+	fresh   bool          // Whether the resolution or palette changed since the last frame.
+	frames  []gifFrame    // The distinct frames captured.
+}
+
+// A distinct frame of a GIF, as it's to be drawn.
+type gifFrame struct {
+	bitmap  Bitmap        // The pixels of the frame.
+	scale   int           // The size of each pixel.
+	palette [4]color.RGBA // The colours of each pixel value.
+	ticks   int           // The number of 60hz ticks the frame is shown for.
+}
+
+// Builds a new capture writing a GIF to the given writer once closed.
+// The scale is the size of each high resolution pixel.
+func NewGIFCapture(writer io.Writer, scale int) *GIFCapture {
+	return &GIFCapture{writer: writer, canvas: newCanvas(scale)}
+}
+
+// Scales the frames of the given resolution to fill the GIF.
+func (capture *GIFCapture) Resize(width, height int) error {
+	capture.canvas.resize(width, height)
+	capture.fresh = true
+	return nil
+}
+
+// Selects the colours of each pixel value.
+func (capture *GIFCapture) SetPalette(palette [4]color.RGBA) error {
+	capture.palette = palette
+	capture.fresh = true
+	return nil
+}
+
+// Adds the frame to the GIF, or extends the last frame if they're identical.
+func (capture *GIFCapture) Present(frame *Bitmap) error {
+	if last := len(capture.frames) - 1; !capture.fresh && last >= 0 && *frame == capture.frames[last].bitmap {
+		capture.frames[last].ticks++
+		return nil
+	}
+	capture.frames = append(capture.frames, gifFrame{*frame, capture.canvas.scale, capture.palette, 1})
+	capture.fresh = false
+	return nil
+}
+
+// Encodes the captured frames as a looping GIF.
+func (capture *GIFCapture) Close() error {
+	if len(capture.frames) == 0 {
+		return fmt.Errorf("no frames were captured")
+	}
+	// GIF delays are in hundredths of a second, so round each frame's end to
+	// the nearest hundredth to keep the GIF in time overall
+	animation := &gif.GIF{
+		Image: make([]*image.Paletted, len(capture.frames)),
+		Delay: make([]int, len(capture.frames)),
+	}
+	elapsed, shown := 0, 0
+	for i, frame := range capture.frames {
+		animation.Image[i] = frame.bitmap.PaletteImage(frame.scale, frame.palette)
+		elapsed += frame.ticks
+		end := (elapsed*100 + FrameRate/2) / FrameRate
+		animation.Delay[i] = end - shown
+		shown = end
+	}
+	return gif.EncodeAll(capture.writer, animation)
+}
+
+// Records frames into an uncompressed YUV4MPEG2 video, as they're presented.
+// Colours are converted to full range Y'CbCr, without chroma subsampling.
+type Y4MCapture struct {
+	writer  *bufio.Writer // The destination of the video.
+	canvas  canvas        // The size of the video.
+	colours [4][3]byte    // The Y'CbCr colours of each pixel value.
+	started bool          // Whether the header has been written.
+	planes  [3][]byte     // The Y', Cb and Cr planes of a frame; reused between frames.
+}
+
+// Builds a new capture streaming a video to the given writer.
+// The scale is the size of each high resolution pixel.
+func NewY4MCapture(writer io.Writer, scale int) *Y4MCapture {
+	capture := &Y4MCapture{writer: bufio.NewWriter(writer), canvas: newCanvas(scale)}
+	for i := range capture.planes {
+		capture.planes[i] = make([]byte, capture.canvas.width*capture.canvas.height)
+	}
+	return capture
+}
+
+// Scales the frames of the given resolution to fill the video.
+func (capture *Y4MCapture) Resize(width, height int) error {
+	capture.canvas.resize(width, height)
+	return nil
+}
+
+// Selects the colours of each pixel value.
+func (capture *Y4MCapture) SetPalette(palette [4]color.RGBA) error {
+	for i, colour := range palette {
+		y, cb, cr := color.RGBToYCbCr(colour.R, colour.G, colour.B)
+		capture.colours[i] = [3]byte{y, cb, cr}
+	}
+	return nil
+}
+
+// Appends the frame to the video, writing the video's header before the first frame.
+func (capture *Y4MCapture) Present(frame *Bitmap) error {
+	canvas := capture.canvas
+	if !capture.started {
+		fmt.Fprintf(capture.writer, "YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C444 XCOLORRANGE=FULL\n", canvas.width, canvas.height, FrameRate)
+		capture.started = true
+	}
+	for y := 0; y < canvas.height; y++ {
+		for x := 0; x < canvas.width; x++ {
+			colour := capture.colours[frame.GetPixel(x/canvas.scale, y/canvas.scale)&AllPlanes]
+			for plane := range capture.planes {
+				capture.planes[plane][x+y*canvas.width] = colour[plane]
+			}
+		}
+	}
+
+	capture.writer.WriteString("FRAME\n")
+	for _, plane := range capture.planes {
+		if _, err := capture.writer.Write(plane); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flushes the remainder of the video.
+func (capture *Y4MCapture) Close() error {
+	return capture.writer.Flush()
+}
@@ -0,0 +1,112 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bytes"
+	"image/gif"
+	"reflect"
+	"testing"
+)
+
+// Presents a sequence of frames to the capture; a second of a blank low
+// resolution display, a lit pixel for a frame, then a second of high resolution.
+func presentFrames(t *testing.T, capture Capture) {
+	screen := NewScreen(capture)
+	present := func(bitmap *Bitmap, frames int) {
+		for i := 0; i < frames; i++ {
+			if err := screen.Present(bitmap); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var bitmap Bitmap
+	present(&bitmap, FrameRate)
+	bitmap.writeSprite([]byte{0x80}, 8, 1, 0, 1, true)
+	present(&bitmap, 1)
+	bitmap.setHiRes(true)
+	present(&bitmap, FrameRate)
+	if err := capture.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Asserts identical frames are merged, and the GIF keeps time and size across resolutions.
+func TestGIFCapture(t *testing.T) {
+	var file bytes.Buffer
+	presentFrames(t, NewGIFCapture(&file, 2))
+
+	animation, err := gif.DecodeAll(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "frames", len(animation.Image), 3)
+	if expected := []int{100, 2, 100}; !reflect.DeepEqual(animation.Delay, expected) {
+		t.Errorf("Delays were %v; expected %v", animation.Delay, expected)
+	}
+	for i, frame := range animation.Image {
+		assertEquals(t, "width", frame.Rect.Dx(), 256)
+		assertEquals(t, "height", frame.Rect.Dy(), 128)
+		// the lit low resolution pixel covers four high resolution pixels
+		lit := i == 1
+		assertEquals(t, "lit", frame.ColorIndexAt(4, 0) == 1 && frame.ColorIndexAt(7, 3) == 1, lit)
+		assertEquals(t, "unlit", frame.ColorIndexAt(8, 0), 0)
+	}
+}
+
+// Asserts every frame of the video is written at the same size.
+func TestY4MCapture(t *testing.T) {
+	var file bytes.Buffer
+	presentFrames(t, NewY4MCapture(&file, 1))
+
+	header := "YUV4MPEG2 W128 H64 F60:1 Ip A1:1 C444 XCOLORRANGE=FULL\n"
+	frame := len("FRAME\n") + 3*128*64
+	if !bytes.HasPrefix(file.Bytes(), []byte(header)) {
+		t.Fatalf("Unexpected header %q", file.Bytes()[:len(header)])
+	}
+	if expected := len(header) + (2*FrameRate+1)*frame; file.Len() != expected {
+		t.Fatalf("Video was %d bytes; expected %d", file.Len(), expected)
+	}
+
+	// the luma of the lit pixel in the 61st frame
+	luma := file.Bytes()[len(header)+FrameRate*frame+len("FRAME\n"):]
+	assertEquals(t, "lit", luma[2], 0xFF)
+	assertEquals(t, "lit", luma[3+128], 0xFF)
+	assertEquals(t, "unlit", luma[4], 0x00)
+}
+
+// Asserts frames whose compressed data spans many GIF sub-blocks are decoded intact.
+func TestGIFCaptureDetailedFrame(t *testing.T) {
+	var bitmap Bitmap
+	bitmap.setHiRes(true)
+	for y := 0; y < HiResHeight; y++ {
+		for x := 0; x < HiResWidth; x += 8 {
+			bitmap.writeSprite([]byte{byte(x*7 + y*13)}, 8, byte(x), byte(y), 1, true)
+		}
+	}
+	var file bytes.Buffer
+	capture := NewGIFCapture(&file, 1)
+	screen := NewScreen(capture)
+	if err := screen.Present(&bitmap); err != nil {
+		t.Fatal(err)
+	}
+	if err := capture.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	animation, err := gif.DecodeAll(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := animation.Image[0]
+	for y := 0; y < HiResHeight; y++ {
+		for x := 0; x < HiResWidth; x++ {
+			if expected := bitmap.GetPixel(x, y) & AllPlanes; frame.ColorIndexAt(x, y) != expected {
+				t.Fatalf("Pixel (%d, %d) was %d; expected %d", x, y, frame.ColorIndexAt(x, y), expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,456 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type WatchKind int // The kinds of memory access which trigger a watchpoint.
+
+const (
+	WatchRead  WatchKind = 1 << iota // The watchpoint triggers when the memory is read.
+	WatchWrite                       // The watchpoint triggers when the memory is written.
+)
+
+// The watchpoint triggers when the memory is either read or written.
+const WatchAccess = WatchRead | WatchWrite
+
+// Describes the watch kind in a human readable form.
+func (kind WatchKind) String() string {
+	switch kind {
+	case WatchRead:
+		return "read"
+	case WatchWrite:
+		return "write"
+	case WatchAccess:
+		return "access"
+	}
+	return fmt.Sprintf("watch %d", int(kind))
+}
+
+// A range of memory which pauses the machine when accessed.
+type Watchpoint struct {
+	Address uint16    // The first address watched.
+	Length  int       // The number of bytes watched.
+	Kind    WatchKind // The kinds of access which trigger the watchpoint.
+}
+
+// Determines if the watchpoint overlaps the given range of memory.
+func (watchpoint Watchpoint) overlaps(address uint16, length int) bool {
+	start, end := int(watchpoint.Address), int(watchpoint.Address)+watchpoint.Length
+	return int(address) < end && int(address)+length > start
+}
+
+// A comparison of a register against a value, e.g. V3 == #10.
+type Condition struct {
+	Register string // The register compared; V0 to VF, I, PC, SP, DT or ST.
+	Operator string // The comparison made; ==, !=, <, <=, > or >=.
+	Value    int    // The value compared against.
+}
+
+// Parses a condition of the form <register> <operator> <value>, e.g. V3 == #10.
+// Values may be decimal, or hexadecimal when prefixed with # or 0x.
+func ParseCondition(text string) (Condition, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 3 {
+		return Condition{}, errors.New("expected a condition of the form <register> <operator> <value>")
+	}
+	condition := Condition{Register: strings.ToUpper(fields[0]), Operator: fields[1]}
+	if _, ok := condition.registerValue(new(CPU)); !ok {
+		return Condition{}, fmt.Errorf("unknown register %s", fields[0])
+	}
+	switch condition.Operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return Condition{}, fmt.Errorf("unknown operator %s", fields[1])
+	}
+	value, err := ParseNumber(fields[2])
+	if err != nil {
+		return Condition{}, err
+	}
+	condition.Value = value
+	return condition, nil
+}
+
+// Parses a number for the debugger; decimal, or hexadecimal when prefixed with # or 0x.
+func ParseNumber(text string) (int, error) {
+	base := 10
+	if strings.HasPrefix(text, "#") {
+		text, base = text[1:], 16
+	} else if strings.HasPrefix(strings.ToLower(text), "0x") {
+		text, base = text[2:], 16
+	}
+	value, err := strconv.ParseInt(text, base, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", text)
+	}
+	return int(value), nil
+}
+
+// Determines if the condition holds for the given CPU.
+func (condition Condition) Holds(cpu *CPU) bool {
+	value, _ := condition.registerValue(cpu)
+	switch condition.Operator {
+	case "==":
+		return value == condition.Value
+	case "!=":
+		return value != condition.Value
+	case "<":
+		return value < condition.Value
+	case "<=":
+		return value <= condition.Value
+	case ">":
+		return value > condition.Value
+	case ">=":
+		return value >= condition.Value
+	}
+	return false
+}
+
+// Retrieves the value of the condition's register.
+func (condition Condition) registerValue(cpu *CPU) (int, bool) {
+	switch condition.Register {
+	case "I":
+		return int(cpu.I), true
+	case "PC":
+		return int(cpu.PC), true
+	case "SP":
+		return int(cpu.SP), true
+	case "DT":
+		return int(cpu.DT), true
+	case "ST":
+		return int(cpu.ST), true
+	}
+	if len(condition.Register) == 2 && condition.Register[0] == 'V' {
+		if index, err := strconv.ParseUint(condition.Register[1:], 16, 8); err == nil {
+			return int(cpu.V[index]), true
+		}
+	}
+	return 0, false
+}
+
+// Formats the condition, e.g. V3 == #10.
+func (condition Condition) String() string {
+	return fmt.Sprintf("%s %s #%X", condition.Register, condition.Operator, condition.Value)
+}
+
+// Describes why the debugger paused the machine.
+type Stop struct {
+	PC     uint16 // The address of the next instruction to be executed.
+	Reason string // What caused the machine to pause, e.g. breakpoint.
+}
+
+// A debugger attached to a machine.
+// Whilst attached, the machine checks breakpoints, watchpoints and conditions
+// after every instruction, and pauses as soon as one is triggered. All of the
+// methods are safe to call whilst the machine is running.
+type Debugger struct {
+	machine     *Machine
+	breakpoints map[uint16]bool // The addresses which pause the machine when reached.
+	watchpoints []Watchpoint    // The memory which pauses the machine when accessed.
+	conditions  []Condition     // The conditions which pause the machine when they become true.
+	held        []bool          // Whether each condition held after the last instruction.
+	target      *stepTarget     // Where a step over or step out finishes, if one is in progress.
+	hit         string          // The watchpoint triggered by the current instruction, if any.
+	stops       chan Stop       // Notified whenever the debugger pauses the machine.
+	history     *History        // The state before each recent instruction, for stepping backwards.
+}
+
+// The number of instructions which may be stepped backwards through.
+const reverseSteps = 1024
+
+// Where a step over or step out finishes; when the stack returns to the given
+// depth, optionally at a given address.
+type stepTarget struct {
+	sp      byte   // The stack depth to return to.
+	pc      uint16 // The address to return to.
+	anyPC   bool   // Whether any address will do.
+	purpose string // The step in progress, for reporting.
+}
+
+// Attaches a new debugger to the given machine, pausing it.
+func NewDebugger(machine *Machine) *Debugger {
+	debugger := &Debugger{
+		machine:     machine,
+		breakpoints: make(map[uint16]bool),
+		stops:       make(chan Stop, 16),
+		history:     NewHistory(reverseSteps),
+	}
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.debugger = debugger
+	machine.paused = true
+	machine.cpu.Watcher = debugger
+	debugger.history.Record(machine.cpu)
+	return debugger
+}
+
+// Retrieves the channel notified whenever the debugger pauses the machine.
+func (debugger *Debugger) Stops() <-chan Stop {
+	return debugger.stops
+}
+
+// Sets a breakpoint at the given address.
+func (debugger *Debugger) Break(address uint16) {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.breakpoints[address] = true
+}
+
+// Watches the given range of memory for the given kinds of access.
+func (debugger *Debugger) Watch(watchpoint Watchpoint) {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	if watchpoint.Length < 1 {
+		watchpoint.Length = 1
+	}
+	debugger.watchpoints = append(debugger.watchpoints, watchpoint)
+}
+
+// Pauses the machine whenever the given condition becomes true.
+func (debugger *Debugger) BreakWhen(condition Condition) {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.conditions = append(debugger.conditions, condition)
+	debugger.held = append(debugger.held, condition.Holds(debugger.machine.cpu))
+}
+
+// Removes any breakpoint and watchpoints at the given address.
+// Returns false if there were none.
+func (debugger *Debugger) Clear(address uint16) bool {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	found := debugger.breakpoints[address]
+	delete(debugger.breakpoints, address)
+
+	watchpoints := debugger.watchpoints[:0]
+	for _, watchpoint := range debugger.watchpoints {
+		if watchpoint.Address == address {
+			found = true
+			continue
+		}
+		watchpoints = append(watchpoints, watchpoint)
+	}
+	debugger.watchpoints = watchpoints
+	return found
+}
+
+// Removes all of the conditions.
+func (debugger *Debugger) ClearConditions() {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.conditions = nil
+	debugger.held = nil
+}
+
+// Retrieves the breakpoint addresses in ascending order, along with the watchpoints and conditions.
+func (debugger *Debugger) List() ([]uint16, []Watchpoint, []Condition) {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	var breakpoints []uint16
+	for address := range debugger.breakpoints {
+		breakpoints = append(breakpoints, address)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool { return breakpoints[i] < breakpoints[j] })
+	watchpoints := append([]Watchpoint(nil), debugger.watchpoints...)
+	conditions := append([]Condition(nil), debugger.conditions...)
+	return breakpoints, watchpoints, conditions
+}
+
+// Resumes the machine until something triggers the debugger.
+func (debugger *Debugger) Continue() {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.target = nil
+	debugger.machine.paused = false
+}
+
+// Pauses the machine, abandoning any step over or step out in progress.
+func (debugger *Debugger) Pause() {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.target = nil
+	debugger.machine.paused = true
+}
+
+// Executes a single instruction, leaving the machine paused. As with the
+// machine, stepping is refused whilst a FrameAccountant is observing.
+func (debugger *Debugger) Step() error {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.target = nil
+	debugger.machine.paused = true
+	if err := debugger.machine.checkStep(); err != nil {
+		return err
+	}
+	return debugger.machine.step()
+}
+
+// Executes a single instruction on behalf of the machine, recording it for
+// reverse stepping and notifying any trigger it reaches. The machine's mutex must be held.
+func (debugger *Debugger) step() error {
+	cpu := debugger.machine.cpu
+	debugger.hit = ""
+	if err := cpu.NextCycle(); err != nil {
+		debugger.notify(err.Error())
+		return err
+	}
+	debugger.history.Record(cpu)
+	if reason := debugger.check(); reason != "" {
+		debugger.notify(reason)
+	}
+	return nil
+}
+
+// Undoes the most recently executed instruction, leaving the machine paused.
+// Only the most recent instructions executed whilst the debugger was attached can be undone.
+func (debugger *Debugger) ReverseStep() error {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.target = nil
+	debugger.machine.paused = true
+	if !debugger.history.Rewind(debugger.machine.cpu) {
+		return errors.New("no earlier instruction has been recorded")
+	}
+	debugger.machine.frame = debugger.machine.cpu.Pixels
+	debugger.hit = ""
+	debugger.updateConditions()
+	return nil
+}
+
+// Executes a single instruction, or a whole subroutine if the instruction is a CALL.
+// The subroutine runs in real time, so the step completes asynchronously; a Stop
+// is sent once it returns, unless something else triggers the debugger first.
+func (debugger *Debugger) StepOver() error {
+	debugger.machine.mutex.Lock()
+	cpu := debugger.machine.cpu
+	if int(cpu.PC)+1 >= cpu.memorySize() || cpu.Memory[cpu.PC]&0xF0 != 0x20 {
+		debugger.machine.mutex.Unlock()
+		return debugger.Step()
+	}
+	defer debugger.machine.mutex.Unlock()
+
+	debugger.target = &stepTarget{sp: cpu.SP, pc: cpu.PC + 2, purpose: "step over"}
+	debugger.machine.paused = false
+	return nil
+}
+
+// Runs until the current subroutine returns.
+// As with StepOver, the step completes asynchronously.
+func (debugger *Debugger) StepOut() error {
+	debugger.machine.mutex.Lock()
+	defer debugger.machine.mutex.Unlock()
+
+	cpu := debugger.machine.cpu
+	if cpu.SP == 0 {
+		return errors.New("not within a subroutine")
+	}
+	debugger.target = &stepTarget{sp: cpu.SP - 1, anyPC: true, purpose: "step out"}
+	debugger.machine.paused = false
+	return nil
+}
+
+// Executes a frame's worth of instructions on behalf of the machine, checking
+// for triggers after each. The machine's mutex must be held.
+func (debugger *Debugger) runFrame(instructions uint) error {
+	machine, cpu := debugger.machine, debugger.machine.cpu
+
+	for i := uint(0); i < instructions && !cpu.Exited; i++ {
+		debugger.hit = ""
+		if err := cpu.NextCycle(); err != nil {
+			machine.paused = true
+			debugger.notify(err.Error())
+			return err
+		}
+		debugger.history.Record(cpu)
+		if reason := debugger.check(); reason != "" {
+			machine.paused = true
+			debugger.target = nil
+			debugger.notify(reason)
+			break
+		}
+	}
+	cpu.TickTimers()
+	return nil
+}
+
+// Determines whether anything has triggered the debugger after an instruction,
+// and if so why.
+func (debugger *Debugger) check() string {
+	cpu := debugger.machine.cpu
+	triggered := debugger.updateConditions()
+
+	switch {
+	case debugger.hit != "":
+		return debugger.hit
+	case debugger.breakpoints[cpu.PC]:
+		return "breakpoint"
+	case triggered != "":
+		return triggered
+	case cpu.Exited:
+		return "program exited"
+	}
+
+	if target := debugger.target; target != nil && cpu.SP == target.sp && (target.anyPC || cpu.PC == target.pc) {
+		return target.purpose
+	}
+	return ""
+}
+
+// Records which conditions hold, returning the first which has just become true.
+func (debugger *Debugger) updateConditions() string {
+	triggered := ""
+	for i, condition := range debugger.conditions {
+		holds := condition.Holds(debugger.machine.cpu)
+		if holds && !debugger.held[i] && triggered == "" {
+			triggered = condition.String()
+		}
+		debugger.held[i] = holds
+	}
+	return triggered
+}
+
+// Sends a stop notification, without blocking the machine if nobody is listening.
+func (debugger *Debugger) notify(reason string) {
+	select {
+	case debugger.stops <- Stop{PC: debugger.machine.cpu.PC, Reason: reason}:
+	default:
+	}
+}
+
+// Triggers any read watchpoints overlapping the given memory.
+func (debugger *Debugger) MemoryRead(address uint16, length int) {
+	debugger.watched(address, length, WatchRead)
+}
+
+// Triggers any write watchpoints overlapping the given memory.
+func (debugger *Debugger) MemoryWritten(address uint16, length int) {
+	debugger.watched(address, length, WatchWrite)
+}
+
+// Records the first watchpoint triggered by the given access.
+func (debugger *Debugger) watched(address uint16, length int, kind WatchKind) {
+	for _, watchpoint := range debugger.watchpoints {
+		if debugger.hit == "" && watchpoint.Kind&kind != 0 && watchpoint.overlaps(address, length) {
+			debugger.hit = fmt.Sprintf("watchpoint #%03X (%s)", watchpoint.Address, kind)
+		}
+	}
+}
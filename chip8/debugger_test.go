@@ -0,0 +1,186 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import "testing"
+
+// A small program with a subroutine, for exercising the debugger.
+var subroutineProgram = []byte{
+	0x22, 0x08, // 200: CALL 208
+	0x71, 0x01, // 202: ADD V1, 1
+	0xF1, 0x33, // 204: LD B, V1
+	0x12, 0x00, // 206: JP 200
+	0x70, 0x01, // 208: ADD V0, 1
+	0x00, 0xEE, // 20A: RET
+}
+
+// Builds a machine running the subroutine program with a debugger attached.
+func newDebuggedMachine() (*Machine, *Debugger) {
+	machine := NewMachine(NewCPU(), 10)
+	machine.LoadProgram(subroutineProgram)
+	return machine, NewDebugger(machine)
+}
+
+// Runs the machine until the debugger pauses it, returning why.
+func runUntilStopped(t *testing.T, machine *Machine, debugger *Debugger) Stop {
+	for frame := 0; frame < 100; frame++ {
+		if err := machine.nextFrame(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case stop := <-debugger.Stops():
+			if !machine.IsPaused() {
+				t.Error("The machine was not paused when the debugger stopped")
+			}
+			return stop
+		default:
+		}
+	}
+	t.Fatal("The debugger never stopped the machine")
+	return Stop{}
+}
+
+// Asserts that the debugger stopped for the expected reason.
+func assertStop(t *testing.T, stop Stop, reason string) {
+	if stop.Reason != reason {
+		t.Errorf("Stopped at 0x%03X for %q; expected %q", stop.PC, stop.Reason, reason)
+	}
+}
+
+// Asserts that the machine stops at breakpoints, and no longer once they're cleared.
+func TestBreakpoints(t *testing.T) {
+	machine, debugger := newDebuggedMachine()
+	if !machine.IsPaused() {
+		t.Error("Attaching a debugger should pause the machine")
+	}
+
+	debugger.Break(0x204)
+	debugger.Continue()
+	stop := runUntilStopped(t, machine, debugger)
+	assertStop(t, stop, "breakpoint")
+	assertEquals(t, "PC", stop.PC, 0x204)
+	assertEquals(t, "V1", machine.cpu.V[1], 1)
+
+	// continuing runs around the loop to the same breakpoint
+	debugger.Continue()
+	stop = runUntilStopped(t, machine, debugger)
+	assertEquals(t, "PC", stop.PC, 0x204)
+	assertEquals(t, "V1", machine.cpu.V[1], 2)
+
+	if !debugger.Clear(0x204) || debugger.Clear(0x204) {
+		t.Error("Expected the breakpoint to be cleared exactly once")
+	}
+}
+
+// Asserts that watchpoints trigger on the kinds of access they watch.
+func TestWatchpoints(t *testing.T) {
+	machine, debugger := newDebuggedMachine()
+	machine.Do(func(cpu *CPU) { cpu.I = 0x300 })
+
+	debugger.Watch(Watchpoint{Address: 0x302, Kind: WatchRead})
+	debugger.Watch(Watchpoint{Address: 0x302, Kind: WatchWrite})
+	debugger.Continue()
+	stop := runUntilStopped(t, machine, debugger)
+	assertStop(t, stop, "watchpoint #302 (write)")
+	assertEquals(t, "PC", stop.PC, 0x206)
+
+	// the watchpoint is just past the written range
+	debugger.Clear(0x302)
+	debugger.Watch(Watchpoint{Address: 0x303, Length: 4, Kind: WatchAccess})
+	debugger.Break(0x20A)
+	debugger.Continue()
+	stop = runUntilStopped(t, machine, debugger)
+	assertStop(t, stop, "breakpoint")
+}
+
+// Asserts that conditions pause the machine as they become true.
+func TestConditions(t *testing.T) {
+	machine, debugger := newDebuggedMachine()
+
+	condition, err := ParseCondition("v0 == #3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	debugger.BreakWhen(condition)
+	debugger.Continue()
+	stop := runUntilStopped(t, machine, debugger)
+	assertStop(t, stop, "V0 == #3")
+	assertEquals(t, "V0", machine.cpu.V[0], 3)
+	assertEquals(t, "PC", stop.PC, 0x20A)
+
+	for _, invalid := range []string{"V0 == ", "VG == 1", "V0 ~ 1", "V0 == #G"} {
+		if _, err := ParseCondition(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// Asserts that stepping over and out of subroutines stops at the right place.
+func TestStepping(t *testing.T) {
+	machine, debugger := newDebuggedMachine()
+
+	// step over the CALL, which runs the whole subroutine
+	if err := debugger.StepOver(); err != nil {
+		t.Fatal(err)
+	}
+	stop := runUntilStopped(t, machine, debugger)
+	assertStop(t, stop, "step over")
+	assertEquals(t, "PC", stop.PC, 0x202)
+	assertEquals(t, "V0", machine.cpu.V[0], 1)
+
+	// stepping over anything else is a single step
+	if err := debugger.StepOver(); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "PC", machine.cpu.PC, 0x204)
+	if err := debugger.StepOut(); err == nil {
+		t.Error("Expected stepping out of the top level to fail")
+	}
+
+	// step into the subroutine, then back out of it
+	debugger.Step()
+	debugger.Step()
+	debugger.Step()
+	assertEquals(t, "PC", machine.cpu.PC, 0x208)
+	if err := debugger.StepOut(); err != nil {
+		t.Fatal(err)
+	}
+	stop = runUntilStopped(t, machine, debugger)
+	assertStop(t, stop, "step out")
+	assertEquals(t, "PC", stop.PC, 0x202)
+	assertEquals(t, "SP", machine.cpu.SP, 0)
+}
+
+// Asserts that reverse stepping undoes instructions one at a time, including their memory writes.
+func TestReverseStep(t *testing.T) {
+	machine, debugger := newDebuggedMachine()
+	if err := debugger.ReverseStep(); err == nil {
+		t.Error("Expected reverse stepping before any instructions to fail")
+	}
+
+	// CALL, ADD V0, RET, ADD V1, LD B
+	machine.Do(func(cpu *CPU) { cpu.I = 0x300 })
+	for i := 0; i < 5; i++ {
+		debugger.Step()
+	}
+	assertEquals(t, "Memory[0x302]", machine.cpu.Memory[0x302], 1)
+
+	expected := []struct{ pc, sp, v0, v1 int }{
+		{0x204, 0, 1, 1}, // before LD B
+		{0x202, 0, 1, 0}, // before ADD V1
+		{0x20A, 1, 1, 0}, // before RET
+		{0x208, 1, 0, 0}, // before ADD V0
+	}
+	for _, state := range expected {
+		if err := debugger.ReverseStep(); err != nil {
+			t.Fatal(err)
+		}
+		assertEquals(t, "PC", machine.cpu.PC, state.pc)
+		assertEquals(t, "SP", machine.cpu.SP, state.sp)
+		assertEquals(t, "V0", machine.cpu.V[0], state.v0)
+		assertEquals(t, "V1", machine.cpu.V[1], state.v1)
+	}
+	assertEquals(t, "Memory[0x302]", machine.cpu.Memory[0x302], 0)
+}
@@ -0,0 +1,264 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+// This package implements a disassembler for Chip 8 programs.
+// Mnemonics follow those in the CPU's decoder, in the style of the CHIPPER
+// assembler, so listings may be compared against hand-written sources.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Flow int // How control flows on from an instruction.
+
+const (
+	Continue Flow = iota // Execution continues with the next instruction.
+	Skip                 // Execution continues with either the next instruction, or the one after.
+	Jump                 // Execution continues at the target address only.
+	Call                 // Execution continues at the target address, and later returns to the next instruction.
+	Return               // Execution returns to the caller.
+	Halt                 // Execution stops.
+	Indirect             // Execution continues at an address which can't be determined statically.
+	Invalid              // The opcode could not be decoded.
+)
+
+// A single decoded instruction.
+type Instruction struct {
+	Address   uint16   // The address of the instruction.
+	Opcode    uint16   // The first 16-bit word of the instruction.
+	Size      int      // The size of the instruction, in bytes; 4 for the XO-CHIP's long load.
+	Mnemonic  string   // The instruction mnemonic, e.g. LD.
+	Operands  []string // The formatted operands, e.g. V1 and #23.
+	Flow      Flow     // How control flows on from the instruction.
+	Target    uint16   // The address referenced by the instruction, if any.
+	HasTarget bool     // Whether the instruction references an address.
+	IsData    bool     // Whether the referenced address is data, rather than code.
+	operand   int      // The index of the operand holding the target address.
+}
+
+// Formats the instruction, e.g. LD V1, #23.
+func (instruction Instruction) String() string {
+	return instruction.format(nil)
+}
+
+// Formats the instruction, substituting a label for the target address if one exists.
+func (instruction Instruction) format(labels map[uint16]string) string {
+	operands := instruction.Operands
+	if label, ok := labels[instruction.Target]; ok && instruction.HasTarget {
+		operands = append([]string(nil), operands...)
+		operands[instruction.operand] = label
+	}
+	if len(operands) == 0 {
+		return instruction.Mnemonic
+	}
+	return fmt.Sprintf("%-4s %s", instruction.Mnemonic, strings.Join(operands, ", "))
+}
+
+// Decodes the instruction at the given address of the given memory image.
+// The image is assumed to begin at the given origin.
+func Decode(memory []byte, origin, address uint16) Instruction {
+	offset := int(address) - int(origin)
+	instruction := Instruction{Address: address, Size: 2, Flow: Invalid, operand: -1}
+	if offset < 0 || offset+1 >= len(memory) {
+		instruction.Mnemonic = "???"
+		return instruction
+	}
+	opcode := uint16(memory[offset])<<8 | uint16(memory[offset+1])
+	instruction.Opcode = opcode
+
+	// extract common operands from the opcode
+	x := byte((opcode & 0x0F00) >> 8)
+	y := byte((opcode & 0x00F0) >> 4)
+	n := byte(opcode & 0x000F)
+	kk := byte(opcode)
+	nnn := opcode & 0x0FFF
+
+	Vx := fmt.Sprintf("V%X", x)
+	Vy := fmt.Sprintf("V%X", y)
+	byteOperand := fmt.Sprintf("#%02X", kk)
+	nibble := fmt.Sprintf("%d", n)
+
+	// records the decoded mnemonic and operands
+	set := func(flow Flow, mnemonic string, operands ...string) {
+		instruction.Flow = flow
+		instruction.Mnemonic = mnemonic
+		instruction.Operands = operands
+	}
+	// records the address operand, which is always the last
+	target := func(address uint16, data bool) {
+		instruction.Target = address
+		instruction.HasTarget = true
+		instruction.IsData = data
+		instruction.operand = len(instruction.Operands) - 1
+	}
+	addr := fmt.Sprintf("#%03X", nnn)
+
+	switch opcode & 0xF000 {
+	case 0x0000:
+		switch {
+		case opcode&0xFFF0 == 0x00C0:
+			set(Continue, "SCD", nibble)
+		case opcode&0xFFF0 == 0x00D0:
+			set(Continue, "SCU", nibble)
+		case opcode == 0x00E0:
+			set(Continue, "CLS")
+		case opcode == 0x00EE:
+			set(Return, "RET")
+		case opcode == 0x00FB:
+			set(Continue, "SCR")
+		case opcode == 0x00FC:
+			set(Continue, "SCL")
+		case opcode == 0x00FD:
+			set(Halt, "EXIT")
+		case opcode == 0x00FE:
+			set(Continue, "LOW")
+		case opcode == 0x00FF:
+			set(Continue, "HIGH")
+		case opcode == 0x0000:
+			// almost certainly padding rather than a machine code call
+			set(Invalid, "SYS", addr)
+		default:
+			set(Continue, "SYS", addr)
+		}
+
+	case 0x1000:
+		set(Jump, "JP", addr)
+		target(nnn, false)
+
+	case 0x2000:
+		set(Call, "CALL", addr)
+		target(nnn, false)
+
+	case 0x3000:
+		set(Skip, "SE", Vx, byteOperand)
+
+	case 0x4000:
+		set(Skip, "SNE", Vx, byteOperand)
+
+	case 0x5000:
+		switch n {
+		case 0x0:
+			set(Skip, "SE", Vx, Vy)
+		case 0x2:
+			set(Continue, "SAVE", Vx+" - "+Vy)
+		case 0x3:
+			set(Continue, "LOAD", Vx+" - "+Vy)
+		}
+
+	case 0x6000:
+		set(Continue, "LD", Vx, byteOperand)
+
+	case 0x7000:
+		set(Continue, "ADD", Vx, byteOperand)
+
+	case 0x8000:
+		switch n {
+		case 0x0:
+			set(Continue, "LD", Vx, Vy)
+		case 0x1:
+			set(Continue, "OR", Vx, Vy)
+		case 0x2:
+			set(Continue, "AND", Vx, Vy)
+		case 0x3:
+			set(Continue, "XOR", Vx, Vy)
+		case 0x4:
+			set(Continue, "ADD", Vx, Vy)
+		case 0x5:
+			set(Continue, "SUB", Vx, Vy)
+		case 0x6:
+			set(Continue, "SHR", shiftOperands(x, y)...)
+		case 0x7:
+			set(Continue, "SUBN", Vx, Vy)
+		case 0xE:
+			set(Continue, "SHL", shiftOperands(x, y)...)
+		}
+
+	case 0x9000:
+		if n == 0 {
+			set(Skip, "SNE", Vx, Vy)
+		}
+
+	case 0xA000:
+		set(Continue, "LD", "I", addr)
+		target(nnn, true)
+
+	case 0xB000:
+		set(Indirect, "JP", "V0", addr)
+		target(nnn, false)
+
+	case 0xC000:
+		set(Continue, "RND", Vx, byteOperand)
+
+	case 0xD000:
+		set(Continue, "DRW", Vx, Vy, nibble)
+
+	case 0xE000:
+		switch kk {
+		case 0x9E:
+			set(Skip, "SKP", Vx)
+		case 0xA1:
+			set(Skip, "SKNP", Vx)
+		}
+
+	case 0xF000:
+		switch kk {
+		case 0x00:
+			if x == 0 && offset+3 < len(memory) {
+				long := uint16(memory[offset+2])<<8 | uint16(memory[offset+3])
+				set(Continue, "LD", "I", fmt.Sprintf("#%04X", long))
+				target(long, true)
+				instruction.Size = 4
+			}
+		case 0x01:
+			if x <= 0x3 {
+				set(Continue, "PLANE", fmt.Sprintf("%d", x))
+			}
+		case 0x02:
+			if x == 0 {
+				set(Continue, "AUDIO")
+			}
+		case 0x07:
+			set(Continue, "LD", Vx, "DT")
+		case 0x0A:
+			set(Continue, "LD", Vx, "K")
+		case 0x15:
+			set(Continue, "LD", "DT", Vx)
+		case 0x18:
+			set(Continue, "LD", "ST", Vx)
+		case 0x1E:
+			set(Continue, "ADD", "I", Vx)
+		case 0x29:
+			set(Continue, "LD", "F", Vx)
+		case 0x30:
+			set(Continue, "LD", "HF", Vx)
+		case 0x33:
+			set(Continue, "LD", "B", Vx)
+		case 0x3A:
+			set(Continue, "PITCH", Vx)
+		case 0x55:
+			set(Continue, "LD", "[I]", Vx)
+		case 0x65:
+			set(Continue, "LD", Vx, "[I]")
+		case 0x75:
+			set(Continue, "LD", "R", Vx)
+		case 0x85:
+			set(Continue, "LD", Vx, "R")
+		}
+	}
+
+	if instruction.Mnemonic == "" {
+		instruction.Mnemonic = "???"
+	}
+	return instruction
+}
+
+// Formats the operands of a shift; Vy is omitted when it's V0, as CHIPPER does.
+func shiftOperands(x, y byte) []string {
+	if y == 0 {
+		return []string{fmt.Sprintf("V%X", x)}
+	}
+	return []string{fmt.Sprintf("V%X", x), fmt.Sprintf("V%X", y)}
+}
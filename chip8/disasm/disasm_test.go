@@ -0,0 +1,79 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package disasm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Expected formatting for a selection of opcodes.
+var DecodeTests = map[uint16]string{
+	0x00E0: "CLS",
+	0x00EE: "RET",
+	0x00C4: "SCD  4",
+	0x1234: "JP   #234",
+	0x2345: "CALL #345",
+	0x3A12: "SE   VA, #12",
+	0x5120: "SE   V1, V2",
+	0x5132: "SAVE V1 - V3",
+	0x8106: "SHR  V1",
+	0x812E: "SHL  V1, V2",
+	0xA2EA: "LD   I, #2EA",
+	0xB300: "JP   V0, #300",
+	0xDAB6: "DRW  VA, VB, 6",
+	0xE0A1: "SKNP V0",
+	0xF10A: "LD   V1, K",
+	0xF155: "LD   [I], V1",
+	0xF265: "LD   V2, [I]",
+	0xF201: "PLANE 2",
+	0xFFFF: "???",
+}
+
+// Asserts that individual opcodes decode to the expected mnemonics.
+func TestDecode(t *testing.T) {
+	for opcode, expected := range DecodeTests {
+		memory := []byte{byte(opcode >> 8), byte(opcode)}
+		if actual := Decode(memory, 0x200, 0x200).String(); actual != expected {
+			t.Errorf("0x%04X decoded as %q; expected %q", opcode, actual, expected)
+		}
+	}
+
+	long := Decode([]byte{0xF0, 0x00, 0x12, 0x34}, 0x200, 0x200)
+	if long.Size != 4 || long.String() != "LD   I, #1234" {
+		t.Errorf("Long load decoded as %q (%d bytes)", long, long.Size)
+	}
+}
+
+// Asserts that code and data are separated, and jump targets labelled.
+func TestDisassemble(t *testing.T) {
+	program := []byte{
+		0xA2, 0x08, // 200: LD I, D208
+		0x22, 0x06, // 202: CALL L206
+		0x12, 0x02, // 204: JP L202
+		0x00, 0xEE, // 206: RET
+		0xFF, 0x81, // 208: sprite data
+	}
+	listing := Disassemble(program, 0x200)
+
+	var buffer bytes.Buffer
+	if _, err := listing.WriteTo(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	output := buffer.String()
+
+	for _, expected := range []string{
+		"LD   I, D208",
+		"L202:\n    CALL L206",
+		"JP   L202",
+		"L206:\n    RET",
+		"D208:\n    DB   #FF, #81",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in listing:\n%s", expected, output)
+		}
+	}
+}
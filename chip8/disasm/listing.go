@@ -0,0 +1,162 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The number of data bytes listed per line.
+const bytesPerLine = 8
+
+// A single line of a listing; either an instruction, or a run of data bytes.
+type Line struct {
+	Address     uint16       // The address of the first byte on the line.
+	Bytes       []byte       // The bytes represented by the line.
+	Label       string       // The label at this address, if any.
+	Text        string       // The formatted instruction or data directive.
+	Instruction *Instruction // The instruction on the line, or nil if it's data.
+}
+
+// A disassembled program, separated into code and data.
+type Listing struct {
+	Origin uint16            // The address the program is loaded at.
+	Lines  []Line            // The lines of the listing, in address order.
+	Labels map[uint16]string // The generated labels, by address.
+}
+
+// Disassembles the given program, as loaded at the given origin (typically 0x200).
+// Code is separated from data by following the flow of control from the
+// origin; anything which can't be reached is listed as data.
+func Disassemble(program []byte, origin uint16) *Listing {
+	end := int(origin) + len(program)
+	inRange := func(address uint16) bool {
+		return int(address) >= int(origin) && int(address) < end
+	}
+
+	// trace the reachable instructions
+	instructions := make(map[uint16]Instruction)
+	code := make([]bool, len(program))
+	targets := make(map[uint16]bool) // true for code, false for data
+	pending := []uint16{origin}
+
+	for len(pending) > 0 {
+		address := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for inRange(address) {
+			if _, ok := instructions[address]; ok {
+				break // already traced from here
+			}
+			instruction := Decode(program, origin, address)
+			if instruction.Flow == Invalid || int(address)+instruction.Size > end {
+				break
+			}
+			instructions[address] = instruction
+			for i := 0; i < instruction.Size; i++ {
+				code[int(address)-int(origin)+i] = true
+			}
+
+			if instruction.HasTarget && inRange(instruction.Target) {
+				if instruction.IsData {
+					if _, ok := targets[instruction.Target]; !ok {
+						targets[instruction.Target] = false
+					}
+				} else {
+					targets[instruction.Target] = true
+					pending = append(pending, instruction.Target)
+				}
+			}
+
+			next := address + uint16(instruction.Size)
+			stop := false
+			switch instruction.Flow {
+			case Skip:
+				following := Decode(program, origin, next)
+				pending = append(pending, next+uint16(following.Size))
+			case Jump, Return, Halt, Indirect:
+				stop = true
+			}
+			if stop {
+				break
+			}
+			address = next
+		}
+	}
+
+	listing := &Listing{Origin: origin, Labels: make(map[uint16]string)}
+
+	// lay out the lines, so we know which labels are actually placed
+	for offset := 0; offset < len(program); {
+		address := origin + uint16(offset)
+		line := Line{Address: address}
+
+		if instruction, ok := instructions[address]; ok {
+			line.Instruction = &instruction
+			line.Bytes = program[offset : offset+instruction.Size]
+		} else {
+			size := 1
+			for size < bytesPerLine && offset+size < len(program) {
+				next := address + uint16(size)
+				if _, ok := instructions[next]; ok {
+					break
+				}
+				if _, ok := targets[next]; ok {
+					break
+				}
+				size++
+			}
+			line.Bytes = program[offset : offset+size]
+		}
+
+		if isCode, ok := targets[address]; ok {
+			if isCode {
+				line.Label = fmt.Sprintf("L%03X", address)
+			} else {
+				line.Label = fmt.Sprintf("D%03X", address)
+			}
+			listing.Labels[address] = line.Label
+		}
+
+		listing.Lines = append(listing.Lines, line)
+		offset += len(line.Bytes)
+	}
+
+	// format each line, referring to labels where we can
+	for i := range listing.Lines {
+		line := &listing.Lines[i]
+		if line.Instruction != nil {
+			line.Text = line.Instruction.format(listing.Labels)
+			continue
+		}
+		values := make([]string, len(line.Bytes))
+		for j, value := range line.Bytes {
+			values[j] = fmt.Sprintf("#%02X", value)
+		}
+		line.Text = fmt.Sprintf("%-4s %s", "DB", strings.Join(values, ", "))
+	}
+
+	return listing
+}
+
+// Writes the listing in CHIPPER syntax, annotating each line with its address and bytes.
+func (listing *Listing) WriteTo(writer io.Writer) (int64, error) {
+	buffer := bufio.NewWriter(writer)
+	var written int64
+
+	for _, line := range listing.Lines {
+		if line.Label != "" {
+			n, _ := fmt.Fprintf(buffer, "%s:\n", line.Label)
+			written += int64(n)
+		}
+		n, _ := fmt.Fprintf(buffer, "    %-40s ; %03X: %X\n", line.Text, line.Address, line.Bytes)
+		written += int64(n)
+	}
+
+	return written, buffer.Flush()
+}
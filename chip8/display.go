@@ -0,0 +1,100 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Shows the frames drawn by a program; implemented by the host, whether that's
+// a window, a terminal, an image or a remote viewer.
+//
+// Displays are driven through a Screen, which tells them of the resolution and
+// palette before the first frame, and again whenever either changes.
+type Display interface {
+	Resize(width, height int) error         // Adapts the display to a new resolution, in pixels.
+	SetPalette(palette [4]color.RGBA) error // Selects the colours of each pixel value.
+	Present(frame *Bitmap) error            // Shows a frame, at the most recently given resolution.
+}
+
+// Drives a display, so that the resolution changes of SUPER-CHIP and XO-CHIP
+// programs and changes of palette reach every display through a single path.
+type Screen struct {
+	display       Display       // The display being driven.
+	palette       [4]color.RGBA // The palette to present in.
+	width, height int           // The resolution of the display; zero until the first frame.
+	stale         bool          // Whether the palette has changed since it was last given to the display.
+}
+
+// Builds a new screen driving the given display, in the default palette.
+func NewScreen(display Display) *Screen {
+	return &Screen{display: display, palette: Palette, stale: true}
+}
+
+// Changes the palette, from the next frame.
+func (screen *Screen) SetPalette(palette [4]color.RGBA) {
+	screen.palette = palette
+	screen.stale = true
+}
+
+// Presents a frame to the display, resizing it first should the resolution have changed.
+func (screen *Screen) Present(frame *Bitmap) error {
+	if screen.stale {
+		if err := screen.display.SetPalette(screen.palette); err != nil {
+			return err
+		}
+		screen.stale = false
+	}
+	if width, height := frame.Width(), frame.Height(); width != screen.width || height != screen.height {
+		if err := screen.display.Resize(width, height); err != nil {
+			return err
+		}
+		screen.width, screen.height = width, height
+	}
+	return screen.display.Present(frame)
+}
+
+// The palettes which may be chosen by name.
+var Palettes = map[string][4]color.RGBA{
+	"default": Palette,
+	"amber": {
+		{R: 40, G: 20, B: 0, A: 255},
+		{R: 255, G: 176, B: 0, A: 255},
+		{R: 204, G: 110, B: 0, A: 255},
+		{R: 128, G: 64, B: 0, A: 255},
+	},
+	"green": {
+		{R: 15, G: 56, B: 15, A: 255},
+		{R: 155, G: 188, B: 15, A: 255},
+		{R: 139, G: 172, B: 15, A: 255},
+		{R: 48, G: 98, B: 48, A: 255},
+	},
+}
+
+// Parses a palette; either the name of one of the Palettes, or four hexadecimal
+// RGB colours separated by commas, for no planes, plane 1, plane 2 and both
+// planes, e.g. 000000,FFFFFF,AAAAAA,555555.
+func ParsePalette(text string) ([4]color.RGBA, error) {
+	var palette [4]color.RGBA
+	if named, ok := Palettes[text]; ok {
+		return named, nil
+	}
+	colours := strings.Split(text, ",")
+	if len(colours) != len(palette) {
+		return palette, fmt.Errorf("invalid palette %s; expected a name or four colours", text)
+	}
+	for i, colour := range colours {
+		hex := strings.TrimPrefix(strings.TrimSpace(colour), "#")
+		rgb, err := strconv.ParseUint(hex, 16, 24)
+		if err != nil || len(hex) != 6 {
+			return palette, fmt.Errorf("invalid colour %s in palette", colour)
+		}
+		palette[i] = color.RGBA{R: byte(rgb >> 16), G: byte(rgb >> 8), B: byte(rgb), A: 255}
+	}
+	return palette, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"fmt"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// A display which records the calls made to it.
+type recordingDisplay struct {
+	calls []string
+}
+
+func (display *recordingDisplay) Resize(width, height int) error {
+	display.calls = append(display.calls, fmt.Sprintf("resize %dx%d", width, height))
+	return nil
+}
+
+func (display *recordingDisplay) SetPalette(palette [4]color.RGBA) error {
+	display.calls = append(display.calls, fmt.Sprintf("palette %d", palette[1].R))
+	return nil
+}
+
+func (display *recordingDisplay) Present(frame *Bitmap) error {
+	display.calls = append(display.calls, fmt.Sprintf("present %dx%d", frame.Width(), frame.Height()))
+	return nil
+}
+
+// Asserts the display is told of the palette and resolution before the frames
+// which need them, and only when they change.
+func TestScreen(t *testing.T) {
+	display := new(recordingDisplay)
+	screen := NewScreen(display)
+	var bitmap Bitmap
+
+	screen.Present(&bitmap)
+	screen.Present(&bitmap)
+	bitmap.setHiRes(true)
+	screen.Present(&bitmap)
+	screen.SetPalette([4]color.RGBA{1: {R: 7}})
+	screen.Present(&bitmap)
+	bitmap.setHiRes(false)
+	screen.Present(&bitmap)
+
+	expected := []string{
+		"palette 255", "resize 64x32", "present 64x32",
+		"present 64x32",
+		"resize 128x64", "present 128x64",
+		"palette 7", "present 128x64",
+		"resize 64x32", "present 64x32",
+	}
+	if !reflect.DeepEqual(display.calls, expected) {
+		t.Errorf("Calls were\n%v\nexpected\n%v", display.calls, expected)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import "fmt"
+
+type FaultKind int // The category of a CPU fault.
+
+const (
+	UnknownOpcode       FaultKind = iota // The opcode could not be decoded.
+	StackOverflow                        // A CALL was made with a full stack.
+	StackUnderflow                       // A RET was made with an empty stack.
+	MemoryOutOfBounds                    // An instruction accessed memory past the end of RAM.
+	ProgramCounterRange                  // The program counter ran past the end of RAM.
+)
+
+// Describes the fault kind in a human readable form.
+func (kind FaultKind) String() string {
+	switch kind {
+	case UnknownOpcode:
+		return "unknown opcode"
+	case StackOverflow:
+		return "stack overflow"
+	case StackUnderflow:
+		return "stack underflow"
+	case MemoryOutOfBounds:
+		return "memory access out of bounds"
+	case ProgramCounterRange:
+		return "program counter out of range"
+	}
+	return fmt.Sprintf("fault %d", int(kind))
+}
+
+// An error raised by the CPU whilst executing a program.
+// The program counter is left pointing at the faulting instruction.
+type Fault struct {
+	Kind   FaultKind // What went wrong.
+	PC     uint16    // The address of the faulting instruction.
+	Opcode uint16    // The faulting opcode.
+}
+
+// Describes the fault, along with where it occurred.
+func (fault *Fault) Error() string {
+	return fmt.Sprintf("%s at 0x%03X (opcode 0x%04X)", fault.Kind, fault.PC, fault.Opcode)
+}
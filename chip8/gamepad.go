@@ -0,0 +1,155 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"fmt"
+)
+
+// A mapping of gamepad inputs onto the keypad, by the SDL game controller name
+// of each button, e.g. "a" or "dpup". Each direction of an analog stick or
+// trigger is named by its axis with a sign, e.g. "-lefty" for the left stick
+// pushed up, or "+righttrigger" for the right trigger.
+type GamepadMapping map[string]Keycode
+
+// The gamepad inputs which may be mapped.
+var gamepadInputs = map[string]bool{
+	"a": true, "b": true, "x": true, "y": true,
+	"back": true, "guide": true, "start": true,
+	"leftstick": true, "rightstick": true, "leftshoulder": true, "rightshoulder": true,
+	"dpup": true, "dpdown": true, "dpleft": true, "dpright": true,
+	"-leftx": true, "+leftx": true, "-lefty": true, "+lefty": true,
+	"-rightx": true, "+rightx": true, "-righty": true, "+righty": true,
+	"+lefttrigger": true, "+righttrigger": true,
+}
+
+// The mapping used unless a program has its own; the D-pad and left stick are
+// on the keys most programs move with, 2, 4, 6 and 8, and the face buttons on
+// 5, 0, A and B.
+var DefaultGamepadMapping = GamepadMapping{
+	"dpup": 0x2, "dpdown": 0x8, "dpleft": 0x4, "dpright": 0x6,
+	"-lefty": 0x2, "+lefty": 0x8, "-leftx": 0x4, "+leftx": 0x6,
+	"a": 0x5, "b": 0x0, "x": 0xA, "y": 0xB,
+}
+
+// Parses a mapping given as the hexadecimal keypad key of each gamepad input,
+// as in configuration files and the ROM database; e.g. {"dpup": "1", "-lefty": "1"}.
+func ParseGamepadMapping(entries map[string]string) (GamepadMapping, error) {
+	keymap, err := ParseKeymap(entries)
+	if err != nil {
+		return nil, err
+	}
+	for name := range keymap {
+		if !gamepadInputs[name] {
+			return nil, fmt.Errorf("unknown gamepad input %q", name)
+		}
+	}
+	return GamepadMapping(keymap), nil
+}
+
+// Builds a copy of the mapping with the given inputs remapped.
+func (mapping GamepadMapping) Override(overrides GamepadMapping) GamepadMapping {
+	result := make(GamepadMapping, len(mapping)+len(overrides))
+	for name, key := range mapping {
+		result[name] = key
+	}
+	for name, key := range overrides {
+		result[name] = key
+	}
+	return result
+}
+
+// An input of a particular gamepad.
+type gamepadInput struct {
+	controller int32  // The instance ID of the gamepad.
+	name       string // The input's name in the mapping.
+}
+
+// Translates the buttons and axes of any number of gamepads into key presses
+// and releases through the mapping. Keys stay pressed whilst any input mapped
+// to them is held, so the D-pad and stick may be used interchangeably.
+type Gamepads struct {
+	input    KeyInput                 // Where keys are pressed and released.
+	mapping  GamepadMapping           // The key each input presses.
+	deadzone int                      // The distance an axis must move from its centre to press a key.
+	held     map[gamepadInput]Keycode // The key pressed by each input held.
+	presses  [KeyCount]int            // The number of inputs holding each key.
+}
+
+// Builds a new translator pressing keys through the given input. The deadzone
+// is the fraction of an axis' travel, from 0 to 1, ignored around its centre.
+func NewGamepads(input KeyInput, mapping GamepadMapping, deadzone float64) *Gamepads {
+	if deadzone < 0 {
+		deadzone = 0
+	}
+	if deadzone > 1 {
+		deadzone = 1
+	}
+	return &Gamepads{
+		input:    input,
+		mapping:  mapping,
+		deadzone: int(deadzone * 32767),
+		held:     make(map[gamepadInput]Keycode),
+	}
+}
+
+// Notifies the named button of the gamepad was pressed or released.
+func (pads *Gamepads) Button(controller int32, name string, pressed bool) {
+	if pressed {
+		pads.press(gamepadInput{controller, name})
+	} else {
+		pads.release(gamepadInput{controller, name})
+	}
+}
+
+// Notifies the named axis of the gamepad moved to the given position, from
+// -32768 to 32767. The direction it's pushed in is held, and the other released.
+func (pads *Gamepads) Axis(controller int32, name string, value int16) {
+	negative, positive := gamepadInput{controller, "-" + name}, gamepadInput{controller, "+" + name}
+	switch {
+	case int(value) < -pads.deadzone:
+		pads.release(positive)
+		pads.press(negative)
+	case int(value) > pads.deadzone:
+		pads.release(negative)
+		pads.press(positive)
+	default:
+		pads.release(negative)
+		pads.release(positive)
+	}
+}
+
+// Releases every input held on the gamepad, as it was disconnected.
+func (pads *Gamepads) Disconnect(controller int32) {
+	for input := range pads.held {
+		if input.controller == controller {
+			pads.release(input)
+		}
+	}
+}
+
+// Presses the input's key, unless it's unmapped or already held.
+func (pads *Gamepads) press(input gamepadInput) {
+	key, ok := pads.mapping[input.name]
+	if _, held := pads.held[input]; !ok || held {
+		return
+	}
+	pads.held[input] = key
+	if pads.presses[key]++; pads.presses[key] == 1 {
+		pads.input.Press(key)
+	}
+}
+
+// Releases the input's key, once no other input holds it.
+func (pads *Gamepads) release(input gamepadInput) {
+	key, held := pads.held[input]
+	if !held {
+		return
+	}
+	delete(pads.held, input)
+	if pads.presses[key]--; pads.presses[key] == 0 {
+		pads.input.Release(key)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"testing"
+)
+
+// Asserts buttons and axes press and release the keys they're mapped to.
+func TestGamepads(t *testing.T) {
+	keypad := NewKeypad()
+	mapping := DefaultGamepadMapping.Override(GamepadMapping{"dpup": 0x1, "-lefty": 0x1, "-righty": 0xC})
+	pads := NewGamepads(keypad, mapping, 0.25)
+
+	tests := []struct {
+		name    string
+		event   func()
+		pressed []Keycode
+	}{
+		{"button", func() { pads.Button(0, "a", true) }, []Keycode{0x5}},
+		{"unmapped button", func() { pads.Button(0, "start", true) }, []Keycode{0x5}},
+		{"release", func() { pads.Button(0, "a", false) }, nil},
+		{"override", func() { pads.Button(0, "dpup", true) }, []Keycode{0x1}},
+		{"deadzone", func() { pads.Axis(0, "lefty", -8000) }, []Keycode{0x1}},
+		{"stick", func() { pads.Axis(0, "lefty", -20000) }, []Keycode{0x1}},
+		{"shared key held", func() { pads.Button(0, "dpup", false) }, []Keycode{0x1}},
+		{"opposite direction", func() { pads.Axis(0, "lefty", 32767) }, []Keycode{0x8}},
+		{"second gamepad", func() { pads.Axis(1, "righty", -32768) }, []Keycode{0x8, 0xC}},
+		{"centred", func() { pads.Axis(0, "lefty", 100) }, []Keycode{0xC}},
+		{"disconnected", func() { pads.Disconnect(1) }, nil},
+	}
+	for _, test := range tests {
+		test.event()
+		var pressed []Keycode
+		for key := Keycode(0); key < KeyCount; key++ {
+			if keypad.IsPressed(key) {
+				pressed = append(pressed, key)
+			}
+		}
+		if len(pressed) != len(test.pressed) {
+			t.Errorf("%s: pressed %v; expected %v", test.name, pressed, test.pressed)
+			continue
+		}
+		for i := range pressed {
+			assertEquals(t, test.name, byte(pressed[i]), byte(test.pressed[i]))
+		}
+	}
+}
+
+// Asserts mappings are parsed, and unknown inputs rejected.
+func TestParseGamepadMapping(t *testing.T) {
+	mapping, err := ParseGamepadMapping(map[string]string{"dpup": "1", "+righttrigger": "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "dpup", byte(mapping["dpup"]), 0x1)
+	assertEquals(t, "+righttrigger", byte(mapping["+righttrigger"]), 0xF)
+
+	for _, entries := range []map[string]string{{"lefty": "1"}, {"Up": "1"}, {"a": "10"}} {
+		if _, err := ParseGamepadMapping(entries); err == nil {
+			t.Errorf("%v: expected an error", entries)
+		}
+	}
+}
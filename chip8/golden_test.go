@@ -0,0 +1,145 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Regenerate the golden frames of the bundled programs")
+
+// A bundled program, run headlessly for a number of frames with scripted input.
+type GoldenTest struct {
+	Program string // The path of the program, relative to the programs directory.
+	Frames  int    // The number of frames to run.
+	Keys    string // The key script to play, if any.
+	Quirks  string // The quirks profile to run with; modern by default.
+}
+
+var GoldenTests = []GoldenTest{
+	{Program: "GAMES/15PUZZLE", Frames: 300, Keys: "100+6 110-6 160+9 170-9"},
+	{Program: "GAMES/BLINKY", Frames: 600, Keys: "200+3 320-3"},
+	{Program: "GAMES/BLITZ", Frames: 600},
+	{Program: "GAMES/BREAKOUT", Frames: 600, Keys: "100+4 160-4"},
+	{Program: "GAMES/BRIX", Frames: 600, Keys: "100+6 150-6"},
+	{Program: "GAMES/CONNECT4", Frames: 300, Keys: "60:6 100:6 140:5"},
+	{Program: "GAMES/GUESS", Frames: 600, Keys: "300+5 310-5"},
+	{Program: "GAMES/HIDDEN", Frames: 300, Keys: "60:5 120:6 180:5"},
+	{Program: "GAMES/INVADERS", Frames: 600, Keys: "60+5 90-5 200+6 260-6 300+5 310-5"},
+	{Program: "GAMES/KALEID", Frames: 300, Keys: "30:2 60:6 90:8 120:0"},
+	{Program: "GAMES/MAZE", Frames: 300},
+	{Program: "GAMES/MERLIN", Frames: 600},
+	{Program: "GAMES/MISSILE", Frames: 600, Keys: "120+8 125-8 300+8 305-8"},
+	{Program: "GAMES/PONG", Frames: 600, Keys: "100+1 130-1 300+4 340-4"},
+	{Program: "GAMES/PONG2", Frames: 600, Keys: "100+1 130-1"},
+	{Program: "GAMES/PUZZLE", Frames: 300},
+	{Program: "GAMES/SQUASH", Frames: 600, Keys: "100+1 130-1"},
+	{Program: "GAMES/SYZYGY", Frames: 600, Keys: "60:F 200+3 240-3"},
+	{Program: "GAMES/TANK", Frames: 600, Keys: "100+2 140-2 200:5"},
+	{Program: "GAMES/TETRIS", Frames: 600, Keys: "100:4 150+6 180-6"},
+	{Program: "GAMES/TICTAC", Frames: 300, Keys: "60:5 120:1"},
+	{Program: "GAMES/UFO", Frames: 600, Keys: "120:5 300:4"},
+	{Program: "GAMES/VBRIX", Frames: 600, Keys: "60:7 150+1 180-1"},
+	{Program: "GAMES/VERS", Frames: 600, Keys: "60:F 120+7 160-7"},
+	{Program: "GAMES/WALL", Frames: 600, Keys: "100+1 130-1"},
+	{Program: "GAMES/WIPEOFF", Frames: 600, Keys: "100+4 160-4"},
+	{Program: "BISQWIT/hanoi.bin", Frames: 900},
+	{Program: "BISQWIT/hello.bin", Frames: 300},
+	{Program: "BISQWIT/starfield.bin", Frames: 1200},
+}
+
+// The path of the golden frame for the given program.
+func goldenFilename(program string) string {
+	name := strings.TrimSuffix(filepath.Base(program), filepath.Ext(program))
+	return filepath.Join("testdata", "golden", strings.ToLower(name)+".png")
+}
+
+// Asserts that each bundled program draws the same frame as its checked-in golden image.
+// Run with -update to regenerate the images after an intentional change to the emulation.
+func TestGoldenFrames(t *testing.T) {
+	for _, test := range GoldenTests {
+		program, err := ioutil.ReadFile(filepath.Join("../programs", test.Program))
+		if err != nil {
+			t.Fatal(err)
+		}
+		script, err := ParseKeyScript(test.Keys)
+		if err != nil {
+			t.Fatalf("%s: %v", test.Program, err)
+		}
+		quirks := ModernQuirks
+		if test.Quirks != "" {
+			quirks = QuirksProfiles[test.Quirks]
+		}
+
+		cpu := NewCPU()
+		cpu.Quirks = quirks
+		if err := cpu.LoadProgramWith(program, LoadOptions{AllowOddLength: true}); err != nil {
+			t.Fatalf("%s: %v", test.Program, err)
+		}
+		if _, err := cpu.RunFrames(test.Frames, 10, script, nil); err != nil {
+			t.Errorf("%s faulted: %v", test.Program, err)
+			continue
+		}
+		actual := cpu.Pixels.Image(1)
+
+		filename := goldenFilename(test.Program)
+		if *update {
+			if err := writeGolden(filename, actual); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		expected, err := readGolden(filename)
+		if err != nil {
+			t.Errorf("%s: %v; run with -update to create it", test.Program, err)
+			continue
+		}
+		if actual.Rect != expected.Rect || !bytes.Equal(actual.Pix, expected.Pix) {
+			t.Errorf("%s drew a different frame to %s:\n%s", test.Program, filename, cpu.Pixels.String())
+		}
+	}
+}
+
+// Reads a golden frame.
+func readGolden(filename string) (*image.Paletted, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoded, err := png.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	paletted, ok := decoded.(*image.Paletted)
+	if !ok {
+		return nil, os.ErrInvalid
+	}
+	return paletted, nil
+}
+
+// Writes a golden frame.
+func writeGolden(filename string, frame *image.Paletted) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, frame)
+}
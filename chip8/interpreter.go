@@ -7,16 +7,24 @@
 package chip8
 
 import (
-	"log"
-	"math/rand"
-	"time"
+	"errors"
+	"fmt"
 )
 
+// The rate at which the delay and sound timers count down, in hertz.
+const FrameRate = 60
+
 const (
-	Width  = 64 // Display width, in pixels.
-	Height = 32 // Display height, in pixels.
+	ProgramStart       = 0x200 // The address most programs are loaded at, and start from.
+	ETI660ProgramStart = 0x600 // The address programs for the ETI 660 are loaded at, and start from.
 )
 
+// Options controlling how a program is loaded into memory.
+type LoadOptions struct {
+	Address        uint16 // The address to load the program at and start executing from; ProgramStart if zero.
+	AllowOddLength bool   // Whether to accept programs of an odd length; typically those ending with a byte of data.
+}
+
 // The central processing unit of the chip 8 system
 // Memory is laid-out in the following structure:
 // +---------------+= 0xFFF (4095) End of Chip-8 RAM
@@ -41,72 +49,41 @@ const (
 // | Reserved for  |
 // |  interpreter  |
 // +---------------+= 0x000 (0) Start of Chip-8 RAM
+//
+// XO-CHIP programs may address a further 60K beyond 0xFFF, up to 0xFFFF.
 type CPU struct {
-	Memory [4096]byte // The Chip 8 has fixed 4K memory in total.
-	V      [16]byte   // 15 8-bit general purpose registers (V0, V1 through to VE). The 16th is the carry flag.
-	I      uint16     // A 16-bit register.
-	PC     uint16     // A program counter PC (which can have values from 0x000 to 0xFFF).
-	SP     byte       // The stack pointer.
-	Stack  [12]uint16 // The stack of branching instructions; references the program counter.
-	DT, ST byte       // Delay/Sound timers. When above zero, they count down to zero. Counting occurs at 60hz.
-	Keypad *Keypad    // The keypad implementation, provided by the host.
-	Pixels Bitmap     // The pixel bitmap representing the display output.
+	Memory  [65536]byte  // The Chip 8 has fixed 4K memory in total; XO-CHIP extends this to 64K.
+	V       [16]byte     // 15 8-bit general purpose registers (V0, V1 through to VE). The 16th is the carry flag.
+	I       uint16       // A 16-bit register.
+	PC      uint16       // A program counter PC (which can have values from 0x000 to 0xFFF).
+	SP      byte         // The stack pointer.
+	Stack   [12]uint16   // The stack of branching instructions; references the program counter.
+	DT, ST  byte         // Delay/Sound timers. When above zero, they count down to zero. Counting occurs at 60hz.
+	Keypad  *Keypad      // The keypad implementation, provided by the host.
+	Pixels  Bitmap       // The pixel bitmap representing the display output.
+	Quirks  Quirks       // The interpretation of ambiguous instructions.
+	Flags   [16]byte     // The SUPER-CHIP's RPL user flags, persisted by Fx75 and restored by Fx85.
+	Exited  bool         // Whether the program has exited via the SUPER-CHIP's 00FD instruction.
+	Planes  byte         // The XO-CHIP bitplanes selected for drawing; plane 1 by default.
+	Pattern [16]byte     // The XO-CHIP audio pattern buffer; 128 1-bit samples.
+	Pitch   byte         // The XO-CHIP playback rate of the audio pattern buffer.
+	KeyWait KeyWait      // The progress of an Fx0A instruction waiting for a key.
+	Watcher Watcher      // Notified of the memory accessed by each instruction, if set; typically a debugger.
+	Random  RandomSource // The source of the RND instruction's random numbers.
+	Audio   AudioSink    // Plays the sound of each frame, provided by the host; silent by default.
 }
 
-// Represents a bitmap of pixels as used in our Chip 8 implementation.
-// 64 * 32 pixels (2048 total pixels). The origin (0, 0) is in the top left.
-type Bitmap [Width * Height]byte
-
-// Retrieves the pixel value at the given (x, y) coordinates.
-func (bitmap *Bitmap) GetPixel(x, y int) byte {
-	return bitmap[x+y*Width]
-}
-
-// Empties the bitmap's content.
-func (bitmap *Bitmap) clear() {
-	for y := 0; y < Height; y++ {
-		for x := 0; x < Width; x++ {
-			bitmap[x+y*Width] = 0
-		}
-	}
+// Receives notice of the data memory read and written by instructions.
+// Instruction fetches are not reported.
+type Watcher interface {
+	MemoryRead(address uint16, length int)    // Notifies the given range of memory was read.
+	MemoryWritten(address uint16, length int) // Notifies the given range of memory was written.
 }
 
-// Writes a sprite at the given (x, y) coordinates.
-// A sprite is a collection of bits representing pixel values over a range.
-// Returns a flag indicating if an existing pixel was overwritten.
-func (bitmap *Bitmap) writeSprite(sprite []byte, x, y byte) (collided bool) {
-	n := len(sprite)
-
-	for yl := 0; yl < n; yl++ {
-		r := sprite[yl]
-
-		for xl := 0; xl < 8; xl++ {
-			i := 0x80 >> byte(xl)
-			on := (r & byte(i)) == byte(i)
-
-			xpos := uint16(x) + uint16(xl)
-			if xpos >= Width {
-				xpos = xpos - Width
-			}
-
-			ypos := uint16(y) + uint16(yl)
-			if ypos >= Height {
-				ypos = ypos - Height
-			}
-
-			if bitmap[xpos+ypos*Width] == 1 {
-				collided = true // collision detected
-			}
-
-			v := byte(0)
-			if on {
-				v = 0x1
-			}
-
-			bitmap[xpos+ypos*Width] ^= v
-		}
-	}
-	return
+// The progress of an Fx0A instruction, which waits for a key press and release.
+type KeyWait struct {
+	Pressed bool    // Whether a key has been pressed, and is awaiting release.
+	Key     Keycode // The key which was pressed.
 }
 
 // The default font-set for the chip 8 system
@@ -132,61 +109,217 @@ var fontSet = []byte{
 	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
 }
 
+// The location of the large font-set in memory, immediately after the default font-set.
+const bigFontOffset = 0x50
+
+// The large font-set for the SUPER-CHIP high resolution mode
+//
+// Each character is 8 pixels wide by 10 pixels high
+var bigFontSet = []byte{
+	0x3C, 0x7E, 0xE7, 0xC3, 0xC3, 0xC3, 0xC3, 0xE7, 0x7E, 0x3C, // 0
+	0x18, 0x38, 0x58, 0x18, 0x18, 0x18, 0x18, 0x18, 0x18, 0x3C, // 1
+	0x3E, 0x7F, 0xC3, 0x06, 0x0C, 0x18, 0x30, 0x60, 0xFF, 0xFF, // 2
+	0x3C, 0x7E, 0xC3, 0x03, 0x0E, 0x0E, 0x03, 0xC3, 0x7E, 0x3C, // 3
+	0x06, 0x0E, 0x1E, 0x36, 0x66, 0xC6, 0xFF, 0xFF, 0x06, 0x06, // 4
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFC, 0xFE, 0x03, 0xC3, 0x7E, 0x3C, // 5
+	0x3E, 0x7C, 0xC0, 0xC0, 0xFC, 0xFE, 0xC3, 0xC3, 0x7E, 0x3C, // 6
+	0xFF, 0xFF, 0x03, 0x06, 0x0C, 0x18, 0x30, 0x60, 0x60, 0x60, // 7
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7E, 0x7E, 0xC3, 0xC3, 0x7E, 0x3C, // 8
+	0x3C, 0x7E, 0xC3, 0xC3, 0x7F, 0x3F, 0x03, 0x03, 0x3E, 0x7C, // 9
+	0x7E, 0xFF, 0xC3, 0xC3, 0xC3, 0xFF, 0xFF, 0xC3, 0xC3, 0xC3, // A
+	0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, 0xC3, 0xC3, 0xFC, 0xFC, // B
+	0x3C, 0xFF, 0xC3, 0xC0, 0xC0, 0xC0, 0xC0, 0xC3, 0xFF, 0x3C, // C
+	0xFC, 0xFE, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xC3, 0xFE, 0xFC, // D
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, // E
+	0xFF, 0xFF, 0xC0, 0xC0, 0xFF, 0xFF, 0xC0, 0xC0, 0xC0, 0xC0, // F
+}
+
 // Initializes a new CPU.
 func NewCPU() *CPU {
 	cpu := new(CPU)
 	// attach the keyboard
 	cpu.Keypad = NewKeypad()
+	// behave like most modern interpreters
+	cpu.Quirks = ModernQuirks
+	// draw the same random numbers every run, unless seeded otherwise
+	cpu.Random = NewRandomSource(1)
+	// make no sound until the host provides a sink
+	cpu.Audio = NullSink{}
+	cpu.Reset()
+	return cpu
+}
+
+// Resets the CPU to its power-on state, clearing memory and the display.
+// The keypad, quirks profile, watcher, random source and audio sink are preserved.
+func (cpu *CPU) Reset() {
+	*cpu = CPU{Keypad: cpu.Keypad, Quirks: cpu.Quirks, Watcher: cpu.Watcher, Random: cpu.Random, Audio: cpu.Audio}
 	// programs expected to start at 0x200
-	cpu.PC = 0x200
+	cpu.PC = ProgramStart
+	// draw to the first plane, and play the audio pattern at 4000hz
+	cpu.Planes = 0x1
+	cpu.Pitch = 64
 	// load the font-set
 	for i := 0; i < len(fontSet); i++ {
 		cpu.Memory[i] = fontSet[i]
 	}
-	return cpu
+	for i := 0; i < len(bigFontSet); i++ {
+		cpu.Memory[i+bigFontOffset] = bigFontSet[i]
+	}
 }
 
-// Loads a program into the CPU from the given byte slice.
-func (cpu *CPU) LoadProgram(program []byte) {
-	for i := 0; i < len(program); i++ {
-		cpu.Memory[i+0x200] = program[i]
+// Polls the keypad on behalf of an Fx0A instruction.
+// Returns the key once it has been both pressed and released.
+func (cpu *CPU) waitForKey() (Keycode, bool) {
+	if !cpu.KeyWait.Pressed {
+		for key := Keycode(0); key < KeyCount; key++ {
+			if cpu.Keypad.IsPressed(key) {
+				cpu.KeyWait = KeyWait{Pressed: true, Key: key}
+				break
+			}
+		}
+		return 0, false
+	}
+	if cpu.Keypad.IsPressed(cpu.KeyWait.Key) {
+		return 0, false
 	}
+	key := cpu.KeyWait.Key
+	cpu.KeyWait = KeyWait{}
+	return key, true
+}
+
+// Loads a program into the CPU from the given byte slice, at 0x200.
+// Returns an error if the program is empty, of an odd length, or too large
+// for memory; in which case the CPU is left untouched.
+func (cpu *CPU) LoadProgram(program []byte) error {
+	return cpu.LoadProgramWith(program, LoadOptions{})
 }
 
-// Runs the CPU at the given frequency, in hertz
-func (cpu *CPU) RunAtFrequency(frequency uint) {
-	for {
-		cpu.NextCycle() // advance the cpu
-		// tick at a fixed interval (roughly)
-		time.Sleep(time.Second / time.Duration(frequency))
+// Loads a program into the CPU as directed by the options, and starts
+// executing it from the address it was loaded at.
+// Returns an error if the program can't be loaded; in which case the CPU is left untouched.
+func (cpu *CPU) LoadProgramWith(program []byte, options LoadOptions) error {
+	address := int(options.Address)
+	if address == 0 {
+		address = ProgramStart
 	}
+	size := cpu.memorySize()
+	switch {
+	case len(program) == 0:
+		return errors.New("the program is empty")
+	case len(program)%2 != 0 && !options.AllowOddLength:
+		return fmt.Errorf("the program is %d bytes; an odd length, whereas instructions are 2 bytes each, so it may be truncated or corrupt", len(program))
+	case address < ProgramStart:
+		return fmt.Errorf("the load address 0x%03X is reserved for the interpreter; programs are loaded at 0x%03X or above", address, ProgramStart)
+	case address >= size:
+		return fmt.Errorf("the load address 0x%03X is beyond the end of memory at 0x%03X", address, size-1)
+	case address+len(program) > size:
+		return fmt.Errorf("the program is %d bytes, but only %d bytes fit between 0x%03X and the end of memory at 0x%03X", len(program), size-address, address, size-1)
+	}
+
+	copy(cpu.Memory[address:], program)
+	cpu.PC = uint16(address)
+	return nil
 }
 
-// Advances the CPU a single cycle.
-func (cpu *CPU) NextCycle() {
-	// fetch the next instruction based on the program counter
-	opcode := uint16(cpu.Memory[cpu.PC])<<8 | uint16(cpu.Memory[cpu.PC+1])
+// Notifies the watcher, if any, that an instruction read the given range of memory.
+func (cpu *CPU) watchRead(address uint16, length int) {
+	if cpu.Watcher != nil {
+		cpu.Watcher.MemoryRead(address, length)
+	}
+}
 
-	// execute the instruction
-	cpu.decodeAndExecute(opcode)
+// Notifies the watcher, if any, that an instruction wrote the given range of memory.
+func (cpu *CPU) watchWritten(address uint16, length int) {
+	if cpu.Watcher != nil {
+		cpu.Watcher.MemoryWritten(address, length)
+	}
+}
 
-	// advance timers by a single cycle
+// The amount of addressable memory, in bytes.
+func (cpu *CPU) memorySize() int {
+	if cpu.Quirks.LargeMemory {
+		return len(cpu.Memory)
+	}
+	return 0x1000
+}
+
+// Advances the CPU a single frame; executing the given number of instructions
+// before counting down the timers once.
+func (cpu *CPU) RunFrame(instructions uint) error {
+	for i := uint(0); i < instructions && !cpu.Exited; i++ {
+		if err := cpu.NextCycle(); err != nil {
+			return err
+		}
+	}
+	cpu.TickTimers()
+	return nil
+}
+
+// Runs the CPU as fast as possible for the given number of frames, pressing and
+// releasing keys as scripted, and presenting each completed frame to the screen
+// if one is given. Stops early if the program exits, the CPU faults, or the
+// screen fails. Returns the number of frames completed, along with the error if any.
+func (cpu *CPU) RunFrames(frames int, instructions uint, script KeyScript, screen *Screen) (int, error) {
+	for frame := 0; frame < frames; frame++ {
+		if cpu.Exited {
+			return frame, nil
+		}
+		script.Play(frame, cpu.Keypad)
+		if err := cpu.RunFrame(instructions); err != nil {
+			return frame, err
+		}
+		if screen != nil {
+			if err := screen.Present(&cpu.Pixels); err != nil {
+				return frame + 1, err
+			}
+		}
+	}
+	return frames, nil
+}
+
+// Counts the delay and sound timers down by a single tick, playing a frame of
+// sound whilst the sound timer is active and silence otherwise.
+// This should occur at 60hz, independently of the instruction rate.
+func (cpu *CPU) TickTimers() {
 	if cpu.DT > 0 {
 		cpu.DT -= 1
 	}
+	cpu.Audio.PlayFrame(Sound{Playing: cpu.ST > 0, Pattern: cpu.Pattern, Pitch: cpu.Pitch})
 	if cpu.ST > 0 {
-		if cpu.ST == 1 {
-			println("BEEP")
-		}
 		cpu.ST -= 1
 	}
 }
 
+// Advances the CPU a single instruction.
+// Returns a *Fault if the instruction could not be executed.
+func (cpu *CPU) NextCycle() error {
+	// nothing more to do once the program has exited
+	if cpu.Exited {
+		return nil
+	}
+
+	// fetch the next instruction based on the program counter
+	if int(cpu.PC)+1 >= cpu.memorySize() {
+		return &Fault{Kind: ProgramCounterRange, PC: cpu.PC}
+	}
+	opcode := uint16(cpu.Memory[cpu.PC])<<8 | uint16(cpu.Memory[cpu.PC+1])
+
+	// execute the instruction
+	return cpu.decodeAndExecute(opcode)
+}
+
 // Decodes and executes the given opcode.
-func (cpu *CPU) decodeAndExecute(opcode uint16) {
-	// move to the next instruction
+func (cpu *CPU) decodeAndExecute(opcode uint16) error {
+	// move to the next instruction, remembering where we came from
+	pc := cpu.PC
 	cpu.PC += 2
 
+	// rewinds the program counter and reports a fault
+	fault := func(kind FaultKind) error {
+		cpu.PC = pc
+		return &Fault{Kind: kind, PC: pc, Opcode: opcode}
+	}
+
 	// extract common operands from the opcode
 	x := byte((opcode & 0x0F00) >> 8)
 	y := byte((opcode & 0x00F0) >> 4)
@@ -194,6 +327,14 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 	kk := byte(opcode)
 	nnn := opcode & 0x0FFF
 
+	// skips the next instruction, which may be a 4-byte XO-CHIP long load
+	skip := func() {
+		if int(cpu.PC)+1 < cpu.memorySize() && cpu.Memory[cpu.PC] == 0xF0 && cpu.Memory[cpu.PC+1] == 0x00 {
+			cpu.PC += 2
+		}
+		cpu.PC += 2
+	}
+
 	// pointers for commonly accessed registers
 	Vx := &cpu.V[x]
 	Vy := &cpu.V[y]
@@ -202,16 +343,40 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 	// decode and execute the opcode
 	switch opcode & 0xF000 {
 	case 0x0000:
-		switch opcode {
-		case 0x00E0: // CLS
-			cpu.Pixels.clear()
+		switch {
+		case opcode&0xFFF0 == 0x00C0: // SCD nibble
+			cpu.Pixels.scroll(cpu.Planes, 0, int(n))
+
+		case opcode&0xFFF0 == 0x00D0: // SCU nibble
+			cpu.Pixels.scroll(cpu.Planes, 0, -int(n))
 
-		case 0x00EE: // RET
-			cpu.PC = cpu.Stack[cpu.SP%12]
+		case opcode == 0x00E0: // CLS
+			cpu.Pixels.clear(cpu.Planes)
+
+		case opcode == 0x00EE: // RET
+			if cpu.SP == 0 {
+				return fault(StackUnderflow)
+			}
+			cpu.PC = cpu.Stack[cpu.SP]
 			cpu.SP -= 1
 
-		case 0x0000: // SYS addr
-			// no-op
+		case opcode == 0x00FB: // SCR
+			cpu.Pixels.scroll(cpu.Planes, 4, 0)
+
+		case opcode == 0x00FC: // SCL
+			cpu.Pixels.scroll(cpu.Planes, -4, 0)
+
+		case opcode == 0x00FD: // EXIT
+			cpu.Exited = true
+
+		case opcode == 0x00FE: // LOW
+			cpu.Pixels.setHiRes(false)
+
+		case opcode == 0x00FF: // HIGH
+			cpu.Pixels.setHiRes(true)
+
+		default: // SYS addr
+			// ignored by modern interpreters
 			break
 		}
 
@@ -219,26 +384,50 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 		cpu.PC = nnn
 
 	case 0x2000: // CALL addr
-		if cpu.SP+1%12 == 0 {
-			log.Fatal("Overflow in stack pointer")
+		if int(cpu.SP)+1 >= len(cpu.Stack) {
+			return fault(StackOverflow)
 		}
 		cpu.SP += 1
-		cpu.Stack[cpu.SP%12] = cpu.PC
+		cpu.Stack[cpu.SP] = cpu.PC
 		cpu.PC = nnn
 
 	case 0x3000: // SE Vx, byte
 		if *Vx == kk {
-			cpu.PC += 2 // skip the next instruction
+			skip()
 		}
 
 	case 0x4000: // SNE Vx, byte
 		if *Vx != kk {
-			cpu.PC += 2 // skip the next instruction
+			skip()
 		}
 
-	case 0x5000: // SE Vx, Vy
-		if *Vx == *Vy {
-			cpu.PC += 2 // skip the next instruction
+	case 0x5000:
+		switch n {
+		case 0x0: // SE Vx, Vy
+			if *Vx == *Vy {
+				skip()
+			}
+
+		case 0x2: // SAVE Vx - Vy
+			if int(cpu.I)+int(absDiff(x, y)) >= cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
+			for i, r := range registerRange(x, y) {
+				cpu.Memory[cpu.I+uint16(i)] = cpu.V[r]
+			}
+			cpu.watchWritten(cpu.I, int(absDiff(x, y))+1)
+
+		case 0x3: // LOAD Vx - Vy
+			if int(cpu.I)+int(absDiff(x, y)) >= cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
+			for i, r := range registerRange(x, y) {
+				cpu.V[r] = cpu.Memory[cpu.I+uint16(i)]
+			}
+			cpu.watchRead(cpu.I, int(absDiff(x, y))+1)
+
+		default:
+			return fault(UnknownOpcode)
 		}
 
 	case 0x6000: // LD Vx, byte
@@ -254,12 +443,21 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 
 		case 0x0001: // OR Vx, Vy
 			*Vx = *Vy | *Vx
+			if cpu.Quirks.LogicResetsVF {
+				*VF = 0
+			}
 
 		case 0x0002: // AND Vx, Vy
 			*Vx = *Vy & *Vx
+			if cpu.Quirks.LogicResetsVF {
+				*VF = 0
+			}
 
 		case 0x0003: // XOR Vx, Vy
 			*Vx = *Vy ^ *Vx
+			if cpu.Quirks.LogicResetsVF {
+				*VF = 0
+			}
 
 		case 0x0004: // ADD Vx, Vy
 			if *Vy > (0xFF - *Vx) {
@@ -270,7 +468,7 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 			*Vx += *Vy
 
 		case 0x0005: // SUB Vx, Vy
-			if *Vy > (0xFF - *Vx) {
+			if *Vx >= *Vy {
 				*VF = 1
 			} else {
 				*VF = 0
@@ -278,6 +476,9 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 			*Vx -= *Vy
 
 		case 0x0006: // SHR Vx {, Vy}
+			if cpu.Quirks.ShiftUsesVy {
+				*Vx = *Vy
+			}
 			if (*Vx & 0x01) == 0x01 {
 				*VF = 1
 			} else {
@@ -286,39 +487,77 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 			*Vx = *Vx >> 1
 
 		case 0x0007: // SUBN Vx, Vy
-			if *Vy > *Vx {
+			if *Vy >= *Vx {
 				*VF = 1
+			} else {
+				*VF = 0
 			}
 			*Vx = *Vy - *Vx
 
 		case 0x000E: // SHL Vx {, Vy}
+			if cpu.Quirks.ShiftUsesVy {
+				*Vx = *Vy
+			}
 			if (*Vx & 0x80) == 0x80 {
 				*VF = 1
 			} else {
 				*VF = 0
 			}
 			*Vx = *Vx << 1
+
+		default:
+			return fault(UnknownOpcode)
 		}
 
 	case 0x9000: // SNE Vx, Vy
 		if *Vx != *Vy {
-			cpu.PC += 2
+			skip()
 		}
 
 	case 0xA000: // LD I, addr
 		cpu.I = nnn
 
 	case 0xB000: // JP V0, addr
-		cpu.PC = nnn + uint16(cpu.V[0])
+		if cpu.Quirks.JumpUsesVx {
+			cpu.PC = nnn + uint16(*Vx)
+		} else {
+			cpu.PC = nnn + uint16(cpu.V[0])
+		}
 
 	case 0xC000: // RND Vx, byte
-		*Vx = byte(rand.Intn(255)) & kk
+		*Vx = cpu.Random.RandomByte() & kk
 
 	case 0xD000: // DRW Vx, Vy, nibble
+		// a zero height sprite is a 16x16 SUPER-CHIP sprite
+		columns, size := 8, int(n)
+		if n == 0 {
+			columns, size = 16, 32
+		}
+		// each selected plane consumes its own sprite, one after the other
+		planes := 0
+		for plane := byte(0x1); plane <= 0x2; plane <<= 1 {
+			if cpu.Planes&plane != 0 {
+				planes++
+			}
+		}
+		if int(cpu.I)+size*planes > cpu.memorySize() {
+			return fault(MemoryOutOfBounds)
+		}
 		// sample the sprite and render it at the (X, Y) coordinates
-		*VF = 0
-		sprite := cpu.Memory[cpu.I : cpu.I+uint16(n)]
-		if cpu.Pixels.writeSprite(sprite, *Vx, *Vy) {
+		cpu.watchRead(cpu.I, size*planes)
+		collided := false
+		address := int(cpu.I)
+		for plane := byte(0x1); plane <= 0x2; plane <<= 1 {
+			if cpu.Planes&plane == 0 {
+				continue
+			}
+			sprite := cpu.Memory[address : address+size]
+			if cpu.Pixels.writeSprite(sprite, columns, *Vx, *Vy, plane, cpu.Quirks.ClipSprites) {
+				collided = true
+			}
+			address += size
+		}
+		if collided {
 			*VF = 1
 		} else {
 			*VF = 0
@@ -328,25 +567,56 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 		switch opcode & 0x00FF {
 		case 0x009E: // SKP VX
 			if cpu.Keypad.IsPressed(Keycode(*Vx)) {
-				cpu.PC += 2
+				skip()
 			}
 
 		case 0x00A1: // SKNP VX
 			if !cpu.Keypad.IsPressed(Keycode(*Vx)) {
-				cpu.PC += 2
+				skip()
 			}
+
+		default:
+			return fault(UnknownOpcode)
 		}
 
 	case 0xF000:
 		switch opcode & 0x00FF {
+		case 0x0000: // LD I, long
+			if x != 0 {
+				return fault(UnknownOpcode)
+			}
+			if int(cpu.PC)+1 >= cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
+			cpu.I = uint16(cpu.Memory[cpu.PC])<<8 | uint16(cpu.Memory[cpu.PC+1])
+			cpu.PC += 2
+
+		case 0x0001: // PLANE n
+			if x > AllPlanes {
+				return fault(UnknownOpcode)
+			}
+			cpu.Planes = x
+
+		case 0x0002: // AUDIO
+			if x != 0 {
+				return fault(UnknownOpcode)
+			}
+			if int(cpu.I)+len(cpu.Pattern) > cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
+			copy(cpu.Pattern[:], cpu.Memory[cpu.I:])
+			cpu.watchRead(cpu.I, len(cpu.Pattern))
+
 		case 0x0007: // LD Vx, DT
 			*Vx = cpu.DT
 
 		case 0x000A: // LD Vx, K
-			key, err := cpu.Keypad.Read()
-			if err != nil {
-				log.Print(err)
-				return
+			// wait for a key to be pressed and then released, like the original VIP;
+			// the instruction repeats until then, so timers keep counting down
+			key, ok := cpu.waitForKey()
+			if !ok {
+				cpu.PC = pc
+				break
 			}
 			*Vx = byte(key)
 
@@ -360,25 +630,83 @@ func (cpu *CPU) decodeAndExecute(opcode uint16) {
 			cpu.I = cpu.I + uint16(*Vx)
 
 		case 0x0029: // LD F, Vx
-			cpu.I = uint16(*Vx * 0x05)
+			cpu.I = uint16(*Vx&0x0F) * 5
+
+		case 0x0030: // LD HF, Vx
+			cpu.I = bigFontOffset + uint16(*Vx&0x0F)*10
+
+		case 0x003A: // PITCH Vx
+			cpu.Pitch = *Vx
 
 		case 0x0033: // LD B, Vx
+			if int(cpu.I)+3 > cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
 			cpu.Memory[cpu.I] = *Vx / 100
 			cpu.Memory[cpu.I+1] = (*Vx / 10) % 10
 			cpu.Memory[cpu.I+2] = (*Vx % 100) % 10
+			cpu.watchWritten(cpu.I, 3)
 
 		case 0x0055: // LD [I], Vx
+			if int(cpu.I)+int(x) >= cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
 			for i := byte(0); i <= x; i++ {
 				cpu.Memory[cpu.I+uint16(i)] = cpu.V[i]
 			}
+			cpu.watchWritten(cpu.I, int(x)+1)
+			if cpu.Quirks.MemoryMovesI {
+				cpu.I += uint16(x) + 1
+			}
 
 		case 0x0065: // LD Vx, [I]
+			if int(cpu.I)+int(x) >= cpu.memorySize() {
+				return fault(MemoryOutOfBounds)
+			}
 			for i := byte(0); i <= x; i++ {
 				cpu.V[i] = cpu.Memory[cpu.I+uint16(i)]
 			}
+			cpu.watchRead(cpu.I, int(x)+1)
+			if cpu.Quirks.MemoryMovesI {
+				cpu.I += uint16(x) + 1
+			}
+
+		case 0x0075: // LD R, Vx
+			copy(cpu.Flags[:x+1], cpu.V[:x+1])
+
+		case 0x0085: // LD Vx, R
+			copy(cpu.V[:x+1], cpu.Flags[:x+1])
+
+		default:
+			return fault(UnknownOpcode)
 		}
 
 	default:
-		log.Fatal("Unknown opcode: ", opcode)
+		return fault(UnknownOpcode)
+	}
+	return nil
+}
+
+// The absolute difference between two register indices.
+func absDiff(x, y byte) byte {
+	if x > y {
+		return x - y
+	}
+	return y - x
+}
+
+// Lists the register indices from x to y inclusive, in either direction.
+func registerRange(x, y byte) []byte {
+	registers := make([]byte, 0, absDiff(x, y)+1)
+	for i := int(x); ; {
+		registers = append(registers, byte(i))
+		if i == int(y) {
+			return registers
+		}
+		if x < y {
+			i++
+		} else {
+			i--
+		}
 	}
 }
@@ -6,7 +6,6 @@ package chip8
 
 import (
 	"fmt"
-	"math/rand"
 	"testing"
 )
 
@@ -32,6 +31,18 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			nil,
 		},
 	},
+	"00Dn - SCU nibble": {
+		{
+			0x00D2,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Pixels.writeSprite([]byte{0x80}, 8, 1, 3, 1, false)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "(1, 3)", cpu.Pixels.GetPixel(1, 3), 0)
+				assertEquals(t, "(1, 1)", cpu.Pixels.GetPixel(1, 1), 1)
+			},
+		},
+	},
 	"00E0 - CLS": {
 		{
 			// just make sure it doesn't explode
@@ -40,6 +51,18 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			nil,
 		},
 	},
+	"00Cn - SCD nibble": {
+		{
+			0x00C2,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Pixels.writeSprite([]byte{0x80}, 8, 1, 1, 1, false)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "(1, 1)", cpu.Pixels.GetPixel(1, 1), 0)
+				assertEquals(t, "(1, 3)", cpu.Pixels.GetPixel(1, 3), 1)
+			},
+		},
+	},
 	"00EE - RET": {
 		{
 			0x00EE,
@@ -53,6 +76,61 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"00FB - SCR": {
+		{
+			0x00FB,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Pixels.writeSprite([]byte{0x80}, 8, 1, 1, 1, false)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "(1, 1)", cpu.Pixels.GetPixel(1, 1), 0)
+				assertEquals(t, "(5, 1)", cpu.Pixels.GetPixel(5, 1), 1)
+			},
+		},
+	},
+	"00FC - SCL": {
+		{
+			0x00FC,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Pixels.writeSprite([]byte{0x80}, 8, 5, 1, 1, false)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "(5, 1)", cpu.Pixels.GetPixel(5, 1), 0)
+				assertEquals(t, "(1, 1)", cpu.Pixels.GetPixel(1, 1), 1)
+			},
+		},
+	},
+	"00FD - EXIT": {
+		{
+			0x00FD,
+			nil,
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "Exited", cpu.Exited, true)
+			},
+		},
+	},
+	"00FE - LOW": {
+		{
+			0x00FE,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Pixels.setHiRes(true)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "Width", cpu.Pixels.Width(), Width)
+				assertEquals(t, "Height", cpu.Pixels.Height(), Height)
+			},
+		},
+	},
+	"00FF - HIGH": {
+		{
+			0x00FF,
+			nil,
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "Width", cpu.Pixels.Width(), HiResWidth)
+				assertEquals(t, "Height", cpu.Pixels.Height(), HiResHeight)
+			},
+		},
+	},
 	"1nnn - JP ADDR": {
 		{
 			0x10FF,
@@ -130,6 +208,50 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"5xy2 - SAVE Vx - Vy": {
+		{
+			0x5132,
+			func(t *testing.T, cpu *CPU) {
+				cpu.I = 0x300
+				cpu.V[1] = 0xB
+				cpu.V[2] = 0xA
+				cpu.V[3] = 0xD
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "M[I+0]", cpu.Memory[0x300], 0xB)
+				assertEquals(t, "M[I+1]", cpu.Memory[0x301], 0xA)
+				assertEquals(t, "M[I+2]", cpu.Memory[0x302], 0xD)
+				assertEquals(t, "I", cpu.I, 0x300)
+			},
+		},
+		{
+			0x5312,
+			func(t *testing.T, cpu *CPU) {
+				cpu.I = 0x300
+				cpu.V[1] = 0xB
+				cpu.V[2] = 0xA
+				cpu.V[3] = 0xD
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "M[I+0]", cpu.Memory[0x300], 0xD)
+				assertEquals(t, "M[I+2]", cpu.Memory[0x302], 0xB)
+			},
+		},
+	},
+	"5xy3 - LOAD Vx - Vy": {
+		{
+			0x5123,
+			func(t *testing.T, cpu *CPU) {
+				cpu.I = 0x300
+				cpu.Memory[0x300] = 0xB
+				cpu.Memory[0x301] = 0xA
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0xB)
+				assertEquals(t, "V2", cpu.V[2], 0xA)
+			},
+		},
+	},
 	"6xkk - LD Vx, byte": {
 		{
 			0x6123,
@@ -198,7 +320,18 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
-	// TODO: check VF flag in these ops
+	"8xy1 - OR Vx, Vy (VF reset quirk)": {
+		{
+			0x8121,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Quirks.LogicResetsVF = true
+				cpu.V[0xF] = 0x01
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "VF", cpu.V[0xF], 0)
+			},
+		},
+	},
 	"8xy4 - ADD Vx, Vy": {
 		{
 			0x8124,
@@ -220,6 +353,29 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 			func(t *testing.T, cpu *CPU) {
 				assertEquals(t, "V1", cpu.V[1], 0x01)
+				assertEquals(t, "VF", cpu.V[0xF], 1)
+			},
+		},
+		{
+			0x8125,
+			func(t *testing.T, cpu *CPU) {
+				cpu.V[1] = 0x02
+				cpu.V[2] = 0x02
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0x00)
+				assertEquals(t, "VF", cpu.V[0xF], 1)
+			},
+		},
+		{
+			0x8125,
+			func(t *testing.T, cpu *CPU) {
+				cpu.V[1] = 0x01
+				cpu.V[2] = 0x02
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0xFF)
+				assertEquals(t, "VF", cpu.V[0xF], 0)
 			},
 		},
 	},
@@ -235,6 +391,34 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"8xy6 - SHR Vx {, Vy} (shift quirk)": {
+		{
+			0x8126,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Quirks.ShiftUsesVy = true
+				cpu.V[1] = 0x04
+				cpu.V[2] = 0x03
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0x01)
+				assertEquals(t, "VF", cpu.V[0xF], 1)
+			},
+		},
+	},
+	"8xy6 - SHR Vx {, Vy} (XO-CHIP)": {
+		{
+			0x8126,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Quirks = XOChipQuirks
+				cpu.V[1] = 0x80
+				cpu.V[2] = 0x05
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0x02)
+				assertEquals(t, "VF", cpu.V[0xF], 1)
+			},
+		},
+	},
 	"8xy7 - SUBN Vx, Vy": {
 		{
 			0x8127,
@@ -244,6 +428,18 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 			func(t *testing.T, cpu *CPU) {
 				assertEquals(t, "V1", cpu.V[1], 0)
+				assertEquals(t, "VF", cpu.V[0xF], 1)
+			},
+		},
+		{
+			0x8127,
+			func(t *testing.T, cpu *CPU) {
+				cpu.V[1] = 0x05
+				cpu.V[2] = 0x04
+				cpu.V[0xF] = 1
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0xFF)
 				assertEquals(t, "VF", cpu.V[0xF], 0)
 			},
 		},
@@ -260,6 +456,20 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"8xyE - SHL Vx {, Vy} (XO-CHIP)": {
+		{
+			0x812E,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Quirks = XOChipQuirks
+				cpu.V[1] = 0x01
+				cpu.V[2] = 0x81
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0x02)
+				assertEquals(t, "VF", cpu.V[0xF], 1)
+			},
+		},
+	},
 	"9xy0 - SNE Vx, Vy": {
 		{
 			0x9120,
@@ -302,26 +512,84 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"0xBnnn - JP V0, addr (jump quirk)": {
+		{
+			0xB120,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Quirks.JumpUsesVx = true
+				cpu.V[0] = 0xF
+				cpu.V[1] = 0x2
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "PC", cpu.PC, 0x122)
+			},
+		},
+	},
 	"0xCxkk - RND Vx, byte": {
 		{
 			0xC1FF,
 			func(t *testing.T, cpu *CPU) {
-				rand.Seed(1) // fix a seed for our RNG call
+				cpu.Random = fixedRandom(0xFF) // the full range is available
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0x0FF)
 			},
+		},
+		{
+			0xC10F,
 			func(t *testing.T, cpu *CPU) {
-				assertEquals(t, "V1", cpu.V[1], 0x056)
+				cpu.Random = fixedRandom(0x56)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V1", cpu.V[1], 0x006)
 			},
 		},
 		{
 			0xC100,
 			func(t *testing.T, cpu *CPU) {
-				rand.Seed(1) // fix a seed for our RNG call
+				cpu.Random = fixedRandom(0x56)
 			},
 			func(t *testing.T, cpu *CPU) {
 				assertEquals(t, "V1", cpu.V[1], 0x000)
 			},
 		},
 	},
+	"0xDxy0 - DRW Vx, Vy, 0": {
+		{
+			0xD120,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Pixels.setHiRes(true)
+				cpu.I = 0x300
+				for i := 0; i < 32; i++ {
+					cpu.Memory[cpu.I+uint16(i)] = 0xFF
+				}
+				cpu.V[1] = 0x10
+				cpu.V[2] = 0x20
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "(16, 32)", cpu.Pixels.GetPixel(16, 32), 1)
+				assertEquals(t, "(31, 47)", cpu.Pixels.GetPixel(31, 47), 1)
+				assertEquals(t, "(32, 47)", cpu.Pixels.GetPixel(32, 47), 0)
+				assertEquals(t, "(31, 48)", cpu.Pixels.GetPixel(31, 48), 0)
+				assertEquals(t, "VF", cpu.V[0xF], 0)
+			},
+		},
+	},
+	"0xDxyn - DRW Vx, Vy, nibble (both planes)": {
+		{
+			0xD121,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Planes = AllPlanes
+				cpu.I = 0x300
+				cpu.Memory[0x300] = 0x80
+				cpu.Memory[0x301] = 0xC0
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "(0, 0)", cpu.Pixels.GetPixel(0, 0), 0x3)
+				assertEquals(t, "(1, 0)", cpu.Pixels.GetPixel(1, 0), 0x2)
+			},
+		},
+	},
 	"0xEx9E - SKP Vx": {
 		{
 			0xE19E,
@@ -336,7 +604,7 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			0xE19E,
 			func(t *testing.T, cpu *CPU) {
 				cpu.V[1] = 0x1
-				cpu.Keypad[0x1] = true
+				cpu.Keypad.Press(0x1)
 			},
 			func(t *testing.T, cpu *CPU) {
 				assertEquals(t, "PC", cpu.PC, 0x204)
@@ -357,13 +625,72 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			0xE1A1,
 			func(t *testing.T, cpu *CPU) {
 				cpu.V[1] = 0x1
-				cpu.Keypad[0x1] = true
+				cpu.Keypad.Press(0x1)
 			},
 			func(t *testing.T, cpu *CPU) {
 				assertEquals(t, "PC", cpu.PC, 0x202)
 			},
 		},
 	},
+	"F000 nnnn - LD I, long": {
+		{
+			0xF000,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Memory[0x202] = 0xAB
+				cpu.Memory[0x203] = 0xCD
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "I", cpu.I, 0xABCD)
+				assertEquals(t, "PC", cpu.PC, 0x204)
+			},
+		},
+	},
+	"3xkk - SE Vx, byte (skipping a long load)": {
+		{
+			0x3100,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Memory[0x202] = 0xF0
+				cpu.Memory[0x203] = 0x00
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "PC", cpu.PC, 0x206)
+			},
+		},
+	},
+	"Fn01 - PLANE n": {
+		{
+			0xF201,
+			nil,
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "Planes", cpu.Planes, 0x2)
+			},
+		},
+	},
+	"F002 - AUDIO": {
+		{
+			0xF002,
+			func(t *testing.T, cpu *CPU) {
+				cpu.I = 0x300
+				cpu.Memory[0x300] = 0xF0
+				cpu.Memory[0x30F] = 0x0F
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "Pattern[0]", cpu.Pattern[0], 0xF0)
+				assertEquals(t, "Pattern[15]", cpu.Pattern[15], 0x0F)
+			},
+		},
+	},
+	"Fx3A - PITCH Vx": {
+		{
+			0xF13A,
+			func(t *testing.T, cpu *CPU) {
+				cpu.V[1] = 0x70
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "Pitch", cpu.Pitch, 0x70)
+			},
+		},
+	},
 	"0xFx07 - LD Vx, DT": {
 		{
 			0xF107,
@@ -375,6 +702,36 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"0xFx0A - LD Vx, K": {
+		{
+			0xF10A,
+			nil,
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "PC", cpu.PC, 0x200)
+			},
+		},
+		{
+			0xF10A,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Keypad.Press(0x5)
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "PC", cpu.PC, 0x200)
+				assertEquals(t, "KeyWait.Key", byte(cpu.KeyWait.Key), 0x5)
+			},
+		},
+		{
+			0xF10A,
+			func(t *testing.T, cpu *CPU) {
+				cpu.KeyWait = KeyWait{Pressed: true, Key: 0x5}
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "PC", cpu.PC, 0x202)
+				assertEquals(t, "V1", cpu.V[1], 0x5)
+				assertEquals(t, "KeyWait.Pressed", cpu.KeyWait.Pressed, false)
+			},
+		},
+	},
 	"0xFx15 - LD DT, Vx": {
 		{
 			0xF115,
@@ -420,6 +777,17 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"Fx30 - LD HF, Vx": {
+		{
+			0xF130,
+			func(t *testing.T, cpu *CPU) {
+				cpu.V[1] = 0x02
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "I", cpu.I, 0x64)
+			},
+		},
+	},
 	"Fx33 - LD B, Vx": {
 		{
 			0xF133,
@@ -450,6 +818,44 @@ var OpcodeScenarios = map[string]OpcodeScenario{
 			},
 		},
 	},
+	"Fx55 - LD [I], Vx (memory quirk)": {
+		{
+			0xF255,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Quirks.MemoryMovesI = true
+				cpu.I = 0x16
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "I", cpu.I, 0x19)
+			},
+		},
+	},
+	"Fx75 - LD R, Vx": {
+		{
+			0xF175,
+			func(t *testing.T, cpu *CPU) {
+				cpu.V[0] = 0xB
+				cpu.V[1] = 0xA
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "R[0]", cpu.Flags[0], 0xB)
+				assertEquals(t, "R[1]", cpu.Flags[1], 0xA)
+			},
+		},
+	},
+	"Fx85 - LD Vx, R": {
+		{
+			0xF185,
+			func(t *testing.T, cpu *CPU) {
+				cpu.Flags[0] = 0xB
+				cpu.Flags[1] = 0xA
+			},
+			func(t *testing.T, cpu *CPU) {
+				assertEquals(t, "V[0]", cpu.V[0], 0xB)
+				assertEquals(t, "V[1]", cpu.V[1], 0xA)
+			},
+		},
+	},
 	"Fx65 - LD [I], Vx": {
 		{
 			0xF265,
@@ -479,7 +885,9 @@ func TestOpcodes(t *testing.T) {
 				if test.Before != nil {
 					test.Before(t, cpu)
 				}
-				cpu.decodeAndExecute(test.Opcode)
+				if err := cpu.decodeAndExecute(test.Opcode); err != nil {
+					t.Errorf("Unexpected fault: %s", err)
+				}
 				if test.After != nil {
 					test.After(t, cpu)
 				}
@@ -496,11 +904,227 @@ func TestOpcodes(t *testing.T) {
 	}
 }
 
+// Asserts that sprites wrap or clip at the edges of the display.
+func TestSpriteEdges(t *testing.T) {
+	sprite := []byte{0xFF}
+
+	var wrapped Bitmap
+	wrapped.writeSprite(sprite, 8, Width-4, 0, 1, false)
+	assertEquals(t, "wrapped (0, 0)", wrapped.GetPixel(0, 0), 1)
+	assertEquals(t, "wrapped (63, 0)", wrapped.GetPixel(Width-1, 0), 1)
+
+	var clipped Bitmap
+	clipped.writeSprite(sprite, 8, Width-4, 0, 1, true)
+	assertEquals(t, "clipped (0, 0)", clipped.GetPixel(0, 0), 0)
+	assertEquals(t, "clipped (63, 0)", clipped.GetPixel(Width-1, 0), 1)
+
+	var offscreen Bitmap
+	offscreen.writeSprite(sprite, 8, Width+2, 0, 1, true)
+	assertEquals(t, "offscreen (2, 0)", offscreen.GetPixel(2, 0), 1)
+}
+
+// A CPU fault that should be raised by a particular opcode.
+type FaultTest struct {
+	Opcode uint16
+	Before func(cpu *CPU)
+	Kind   FaultKind
+}
+
+// Tests for opcodes which are expected to fault.
+var FaultTests = map[string]FaultTest{
+	"unknown 8xy8":         {0x8128, nil, UnknownOpcode},
+	"unknown ExFF":         {0xE1FF, nil, UnknownOpcode},
+	"unknown FxFF":         {0xF1FF, nil, UnknownOpcode},
+	"unknown 5xy4":         {0x5124, nil, UnknownOpcode},
+	"unknown Fn01 plane":   {0xF401, nil, UnknownOpcode},
+	"RET with empty stack": {0x00EE, nil, StackUnderflow},
+	"CALL with full stack": {
+		0x2300,
+		func(cpu *CPU) { cpu.SP = byte(len(cpu.Stack) - 1) },
+		StackOverflow,
+	},
+	"DRW past end of memory": {
+		0xD125,
+		func(cpu *CPU) { cpu.I = 0xFFE },
+		MemoryOutOfBounds,
+	},
+	"LD B past end of memory": {
+		0xF133,
+		func(cpu *CPU) { cpu.I = 0xFFE },
+		MemoryOutOfBounds,
+	},
+	"LD [I] past end of memory": {
+		0xF255,
+		func(cpu *CPU) { cpu.I = 0xFFE },
+		MemoryOutOfBounds,
+	},
+	"LD Vx, [I] past end of memory": {
+		0xF265,
+		func(cpu *CPU) { cpu.I = 0xFFE },
+		MemoryOutOfBounds,
+	},
+}
+
+// Asserts that faulting opcodes are reported with their location.
+func TestFaults(t *testing.T) {
+	for label, test := range FaultTests {
+		t.Run(label, func(t *testing.T) {
+			cpu := NewCPU()
+			if test.Before != nil {
+				test.Before(cpu)
+			}
+			err := cpu.decodeAndExecute(test.Opcode)
+			fault, ok := err.(*Fault)
+			if !ok {
+				t.Fatalf("Expected a fault, got %v", err)
+			}
+			if fault.Kind != test.Kind {
+				t.Errorf("Kind was %s; expected %s", fault.Kind, test.Kind)
+			}
+			assertEquals(t, "Fault.PC", fault.PC, 0x200)
+			assertEquals(t, "Fault.Opcode", fault.Opcode, test.Opcode)
+			assertEquals(t, "PC", cpu.PC, 0x200)
+		})
+	}
+}
+
+// Asserts that timers count down once per frame, regardless of the instruction rate.
+func TestRunFrame(t *testing.T) {
+	cpu := NewCPU()
+	cpu.LoadProgram([]byte{0x70, 0x01, 0x12, 0x00}) // ADD V0, 1; JP 0x200
+	cpu.DT = 10
+	cpu.ST = 10
+
+	if err := cpu.RunFrame(20); err != nil {
+		t.Fatalf("Unexpected fault: %s", err)
+	}
+	assertEquals(t, "V0", cpu.V[0], 10)
+	assertEquals(t, "DT", cpu.DT, 9)
+	assertEquals(t, "ST", cpu.ST, 9)
+}
+
+// Asserts that programs are loaded where directed, and rejected when they can't be.
+func TestLoadProgram(t *testing.T) {
+	tests := map[string]struct {
+		Size    int
+		Options LoadOptions
+		Quirks  Quirks
+		Valid   bool
+	}{
+		"default":           {Size: 4, Valid: true},
+		"largest":           {Size: 0x1000 - 0x200, Valid: true},
+		"oversized":         {Size: 0x1000 - 0x200 + 2},
+		"empty":             {Size: 0},
+		"odd length":        {Size: 3},
+		"allowed odd":       {Size: 3, Options: LoadOptions{AllowOddLength: true}, Valid: true},
+		"ETI 660":           {Size: 4, Options: LoadOptions{Address: ETI660ProgramStart}, Valid: true},
+		"ETI 660 oversized": {Size: 0x1000 - 0x600 + 2, Options: LoadOptions{Address: ETI660ProgramStart}},
+		"reserved address":  {Size: 4, Options: LoadOptions{Address: 0x100}},
+		"beyond memory":     {Size: 4, Options: LoadOptions{Address: 0x1000}},
+		"large memory":      {Size: 0x1000, Quirks: XOChipQuirks, Valid: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			program := make([]byte, test.Size)
+			for i := range program {
+				program[i] = 0xA5
+			}
+			cpu := NewCPU()
+			cpu.Quirks = test.Quirks
+			err := cpu.LoadProgramWith(program, test.Options)
+			if !test.Valid {
+				if err == nil {
+					t.Fatal("Expected an error")
+				}
+				assertEquals(t, "PC", cpu.PC, ProgramStart)
+				assertEquals(t, "Memory[0x200]", cpu.Memory[0x200], 0)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			address := test.Options.Address
+			if address == 0 {
+				address = ProgramStart
+			}
+			assertEquals(t, "PC", cpu.PC, address)
+			assertEquals(t, "first byte", cpu.Memory[address], 0xA5)
+			assertEquals(t, "last byte", cpu.Memory[int(address)+test.Size-1], 0xA5)
+			assertEquals(t, "byte before", cpu.Memory[address-1], 0)
+		})
+	}
+}
+
+// Asserts that subtractions set VF when they don't borrow, and clear it when they
+// do, whatever VF held before; equal operands don't borrow.
+func TestSubtractionFlags(t *testing.T) {
+	tests := []struct {
+		name      string
+		opcode    uint16
+		vx, vy    byte
+		result    byte
+		notBorrow byte
+	}{
+		{"SUB greater", 0x8125, 0x05, 0x03, 0x02, 1},
+		{"SUB equal", 0x8125, 0x03, 0x03, 0x00, 1},
+		{"SUB borrow", 0x8125, 0x03, 0x05, 0xFE, 0},
+		{"SUBN greater", 0x8127, 0x03, 0x05, 0x02, 1},
+		{"SUBN equal", 0x8127, 0x03, 0x03, 0x00, 1},
+		{"SUBN borrow", 0x8127, 0x05, 0x03, 0xFE, 0},
+	}
+	for _, test := range tests {
+		for _, initial := range []byte{0, 1} {
+			cpu := NewCPU()
+			cpu.V[1], cpu.V[2], cpu.V[0xF] = test.vx, test.vy, initial
+			if err := cpu.decodeAndExecute(test.opcode); err != nil {
+				t.Fatalf("%s: unexpected fault: %s", test.name, err)
+			}
+			assertEquals(t, test.name+" V1", cpu.V[1], test.result)
+			assertEquals(t, test.name+" VF", cpu.V[0xF], test.notBorrow)
+		}
+	}
+}
+
+// Asserts that the larger XO-CHIP memory is only addressable when enabled.
+func TestLargeMemory(t *testing.T) {
+	cpu := NewCPU()
+	cpu.I = 0x8000
+	if err := cpu.decodeAndExecute(0xF065); err == nil {
+		t.Fatalf("Expected a fault addressing 0x8000 with 4K memory")
+	}
+
+	cpu = NewCPU()
+	cpu.Quirks = XOChipQuirks
+	cpu.I = 0x8000
+	cpu.Memory[0x8000] = 0xAB
+	if err := cpu.decodeAndExecute(0xF065); err != nil {
+		t.Fatalf("Unexpected fault: %s", err)
+	}
+	assertEquals(t, "V0", cpu.V[0], 0xAB)
+}
+
+// Asserts that the CPU refuses to run off the end of memory.
+func TestProgramCounterOutOfRange(t *testing.T) {
+	cpu := NewCPU()
+	cpu.PC = 0xFFF
+	err := cpu.NextCycle()
+	if fault, ok := err.(*Fault); !ok || fault.Kind != ProgramCounterRange {
+		t.Fatalf("Expected a program counter fault, got %v", err)
+	}
+}
+
 // Checks the the given value against the expected
 func assertEquals(t *testing.T, subject string, actual, expected interface{}) {
 	// Attempts to convert a value to a uint16
 	asuint16 := func(value interface{}) uint16 {
 		switch value := value.(type) {
+		case bool:
+			if value {
+				return 1
+			}
+			return 0
 		case byte:
 			return uint16(value)
 		case uint16:
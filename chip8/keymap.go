@@ -0,0 +1,117 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A mapping of host keys onto the keypad, by the host key's SDL name; e.g.
+// {"Q": 0x4, "Left": 0x4}. Any number of host keys may map onto the same key
+// of the keypad, and host keys which aren't mapped are ignored.
+type Keymap map[string]Keycode
+
+// The preset keymaps, by name. Each lays the keypad,
+//
+//	1 2 3 C
+//	4 5 6 D
+//	7 8 9 E
+//	A 0 B F
+//
+// out on a block of host keys, except numpad which maps its digits by value.
+var Layouts = map[string]Keymap{
+	"qwerty": {
+		"1": 0x1, "2": 0x2, "3": 0x3, "4": 0xC,
+		"Q": 0x4, "W": 0x5, "E": 0x6, "R": 0xD,
+		"A": 0x7, "S": 0x8, "D": 0x9, "F": 0xE,
+		"Z": 0xA, "X": 0x0, "C": 0xB, "V": 0xF,
+	},
+	// the digits are shifted on AZERTY keyboards, so the unshifted symbols on the same keys map too
+	"azerty": {
+		"1": 0x1, "2": 0x2, "3": 0x3, "4": 0xC,
+		"&": 0x1, "é": 0x2, "\"": 0x3, "'": 0xC,
+		"A": 0x4, "Z": 0x5, "E": 0x6, "R": 0xD,
+		"Q": 0x7, "S": 0x8, "D": 0x9, "F": 0xE,
+		"W": 0xA, "X": 0x0, "C": 0xB, "V": 0xF,
+	},
+	"numpad": {
+		"Keypad 0": 0x0, "Keypad 1": 0x1, "Keypad 2": 0x2, "Keypad 3": 0x3,
+		"Keypad 4": 0x4, "Keypad 5": 0x5, "Keypad 6": 0x6, "Keypad 7": 0x7,
+		"Keypad 8": 0x8, "Keypad 9": 0x9, "Keypad /": 0xA, "Keypad *": 0xB,
+		"Keypad -": 0xC, "Keypad +": 0xD, "Keypad Enter": 0xE, "Keypad .": 0xF,
+	},
+	// as the HP48's keyboard was used by CHIP-48, with its space key on enter
+	"hp48": {
+		"Keypad 7": 0x1, "Keypad 8": 0x2, "Keypad 9": 0x3, "Keypad /": 0xC,
+		"Keypad 4": 0x4, "Keypad 5": 0x5, "Keypad 6": 0x6, "Keypad *": 0xD,
+		"Keypad 1": 0x7, "Keypad 2": 0x8, "Keypad 3": 0x9, "Keypad -": 0xE,
+		"Keypad 0": 0xA, "Keypad .": 0x0, "Keypad Enter": 0xB, "Keypad +": 0xF,
+	},
+}
+
+// Parses a keymap given as the hexadecimal keypad key of each host key, as in
+// configuration files and the ROM database; e.g. {"Up": "1", "Down": "4"}.
+func ParseKeymap(entries map[string]string) (Keymap, error) {
+	keymap := make(Keymap, len(entries))
+	for name, value := range entries {
+		if name == "" {
+			return nil, fmt.Errorf("empty key name in keymap")
+		}
+		key, err := strconv.ParseUint(value, 16, 8)
+		if err != nil || key >= KeyCount {
+			return nil, fmt.Errorf("invalid keypad key %q for %s in keymap", value, name)
+		}
+		keymap[name] = Keycode(key)
+	}
+	return keymap, nil
+}
+
+// Lists the names of the preset keymaps, for usage messages.
+func LayoutNames() string {
+	names := make([]string, 0, len(Layouts))
+	for name := range Layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// Passes key presses and releases on to an input, keeping each key pressed
+// whilst any of the host keys or gamepad inputs mapped to it is held. Each
+// press must be matched by a release; unmatched releases are ignored.
+type KeyCounter struct {
+	input   KeyInput      // Where keys are pressed and released.
+	presses [KeyCount]int // The number of presses holding each key.
+}
+
+// Builds a new counter pressing keys through the given input.
+func NewKeyCounter(input KeyInput) *KeyCounter {
+	return &KeyCounter{input: input}
+}
+
+// Notifies the given key was pressed, pressing it unless it's already held.
+// Keys outside of the keypad's range are ignored.
+func (counter *KeyCounter) Press(key Keycode) {
+	if int(key) >= KeyCount {
+		return
+	}
+	if counter.presses[key]++; counter.presses[key] == 1 {
+		counter.input.Press(key)
+	}
+}
+
+// Notifies the given key was released, releasing it once nothing holds it.
+// Keys outside of the keypad's range are ignored.
+func (counter *KeyCounter) Release(key Keycode) {
+	if int(key) >= KeyCount || counter.presses[key] == 0 {
+		return
+	}
+	if counter.presses[key]--; counter.presses[key] == 0 {
+		counter.input.Release(key)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"testing"
+)
+
+// Asserts every key of the keypad can be pressed in each of the layouts.
+func TestLayouts(t *testing.T) {
+	for name, layout := range Layouts {
+		var mapped [KeyCount]bool
+		for _, key := range layout {
+			mapped[key] = true
+		}
+		for key, ok := range mapped {
+			if !ok {
+				t.Errorf("%s: key %X is unmapped", name, key)
+			}
+		}
+	}
+}
+
+// Asserts keymap entries are parsed, and invalid entries rejected.
+func TestParseKeymap(t *testing.T) {
+	keymap, err := ParseKeymap(map[string]string{"Up": "1", "Down": "4", "Keypad 8": "1", "Space": "f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Keymap{"Up": 0x1, "Down": 0x4, "Keypad 8": 0x1, "Space": 0xF}
+	assertEquals(t, "entries", len(keymap), len(expected))
+	for name, key := range expected {
+		assertEquals(t, name, byte(keymap[name]), byte(key))
+	}
+
+	tests := map[string]map[string]string{
+		"empty name": {"": "1"},
+		"empty key":  {"Up": ""},
+		"large key":  {"Up": "10"},
+		"non-hex":    {"Up": "G"},
+	}
+	for name, entries := range tests {
+		if _, err := ParseKeymap(entries); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Asserts keys stay pressed until every press holding them is released.
+func TestKeyCounter(t *testing.T) {
+	keypad := NewKeypad()
+	counter := NewKeyCounter(keypad)
+
+	tests := []struct {
+		name    string
+		event   func()
+		pressed bool
+	}{
+		{"first press", func() { counter.Press(0x5) }, true},
+		{"second press", func() { counter.Press(0x5) }, true},
+		{"one released", func() { counter.Release(0x5) }, true},
+		{"both released", func() { counter.Release(0x5) }, false},
+		{"unmatched release", func() { counter.Release(0x5) }, false},
+		{"pressed again", func() { counter.Press(0x5) }, true},
+		{"out of range", func() { counter.Press(KeyCount) }, true},
+	}
+	for _, test := range tests {
+		test.event()
+		assertEquals(t, test.name, keypad.IsPressed(0x5), test.pressed)
+	}
+}
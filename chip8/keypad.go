@@ -4,56 +4,80 @@
 
 package chip8
 
+import "sync"
+
 type Keycode byte // Our keycode representation.
 
+// The number of keys on the hexadecimal keypad.
+const KeyCount = 16
+
+// The interface through which host input devices drive the 16-key pad.
+// Keyboards, terminals, scripts and network connections all report their
+// key presses and releases through this, and it may be decorated to record
+// or filter them along the way.
+type KeyInput interface {
+	Press(key Keycode)   // Notifies the given key was pressed.
+	Release(key Keycode) // Notifies the given key was released.
+}
+
 // A keypad implementation for the interpreter.
+// The host presses and releases keys, whilst the CPU polls their state.
 type Keypad struct {
-	pressed  chan Keycode     // A channel of key down events.
-	released chan Keycode     // A channel of key up events.
-	states   map[Keycode]bool // A map of keys, and their state
+	states [KeyCount]bool // The state of each key; true whilst held down.
+	mutex  sync.Mutex     // Guards the key states, which are written by the host and read by the CPU.
 }
 
 // Builds a new default keypad.
 func NewKeypad() *Keypad {
-	const bufferSize = 1000
-	keypad := &Keypad{
-		pressed:  make(chan Keycode, bufferSize),
-		released: make(chan Keycode, bufferSize),
-		states:   make(map[Keycode]bool),
-	}
-	return keypad
+	return &Keypad{}
 }
 
 // Notifies the given key was pressed.
+// Keys outside of the keypad's range are ignored.
 func (keypad *Keypad) Press(key Keycode) {
-	keypad.pressed <- key
-	keypad.states[key] = true
+	keypad.set(key, true)
 }
 
 // Notifies the given key was released.
+// Keys outside of the keypad's range are ignored.
 func (keypad *Keypad) Release(key Keycode) {
-	keypad.released <- key
-	keypad.states[key] = false
+	keypad.set(key, false)
+}
+
+// Updates the state of the given key.
+func (keypad *Keypad) set(key Keycode, pressed bool) {
+	if int(key) >= KeyCount {
+		return
+	}
+	keypad.mutex.Lock()
+	defer keypad.mutex.Unlock()
+
+	keypad.states[key] = pressed
 }
 
 // Determines if the given key is currently pressed.
 func (keypad *Keypad) IsPressed(key Keycode) bool {
+	if int(key) >= KeyCount {
+		return false
+	}
+	keypad.mutex.Lock()
+	defer keypad.mutex.Unlock()
+
 	return keypad.states[key]
 }
 
-// Blocks and reads a key from the keypad.
-func (keypad *Keypad) Read() (Keycode, error) {
-	select {
-	case key := <-keypad.pressed:
-		return key, nil
+// Retrieves the state of every key at once.
+func (keypad *Keypad) snapshot() [KeyCount]bool {
+	keypad.mutex.Lock()
+	defer keypad.mutex.Unlock()
 
-	case key := <-keypad.pressed:
-		return key, nil
-	}
+	return keypad.states
 }
 
-// Closes the keypad by releasing it's channels.
-func (keypad *Keypad) Close() {
-	close(keypad.pressed)
-	close(keypad.released)
+// Replaces the state of every key at once.
+func (keypad *Keypad) restore(states [KeyCount]bool) {
+	keypad.mutex.Lock()
+	defer keypad.mutex.Unlock()
+
+	keypad.states = states
 }
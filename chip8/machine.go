@@ -0,0 +1,290 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A controller which owns the run loop of a CPU.
+// All access to the CPU is serialized, so the host may safely pause, step and
+// inspect the machine from other goroutines whilst it is running.
+type Machine struct {
+	cpu       *CPU            // The CPU being driven.
+	speed     uint            // The number of instructions to execute per frame.
+	program   []byte          // The program loaded into the CPU, retained for resets.
+	options   LoadOptions     // How the program was loaded, retained for resets.
+	paused    bool            // Whether the run loop is currently paused.
+	frame     Bitmap          // The most recently completed frame.
+	mutex     sync.Mutex      // Guards all of the above, and the CPU itself.
+	stop      chan struct{}   // Closed when the machine is stopped.
+	stopOnce  sync.Once       // Ensures the stop channel is only closed once.
+	debugger  *Debugger       // The attached debugger, if any.
+	history   *History        // The recent frames, if rewinding is enabled.
+	observers []FrameObserver // Notified as each frame begins; typically movies and captures.
+	frames    int             // The number of frames run since power on.
+	faults    chan *Fault     // Notified whenever the CPU faults.
+}
+
+// Builds a new machine around the given CPU, executing the given number of instructions per frame.
+func NewMachine(cpu *CPU, instructionsPerFrame uint) *Machine {
+	return &Machine{
+		cpu:    cpu,
+		speed:  instructionsPerFrame,
+		frame:  cpu.Pixels,
+		stop:   make(chan struct{}),
+		faults: make(chan *Fault, 16),
+	}
+}
+
+// Loads a program into the machine's CPU at 0x200, retaining it for subsequent resets.
+// Returns an error if the program can't be loaded.
+func (machine *Machine) LoadProgram(program []byte) error {
+	return machine.LoadProgramWith(program, LoadOptions{})
+}
+
+// Loads a program into the machine's CPU as directed by the options, retaining
+// both for subsequent resets. Returns an error if the program can't be loaded.
+func (machine *Machine) LoadProgramWith(program []byte, options LoadOptions) error {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	if err := machine.cpu.LoadProgramWith(program, options); err != nil {
+		return err
+	}
+	machine.program = append([]byte(nil), program...)
+	machine.options = options
+	return nil
+}
+
+// Runs the machine in real time, until the context is cancelled or the machine
+// is stopped. A fault pauses the machine and is sent to Faults, whilst the run
+// loop carries on so that the host may reset or resume the machine.
+// Returns the context's error, or the error of an observer which stopped the machine.
+func (machine *Machine) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Second / FrameRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-machine.stop:
+			return nil
+
+		case <-ticker.C:
+			if err := machine.nextFrame(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Advances the machine a single frame, unless it is paused.
+func (machine *Machine) nextFrame() error {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	if machine.paused || machine.cpu.Exited {
+		return nil
+	}
+	for _, observer := range machine.observers {
+		if err := observer.BeginFrame(machine.frames, machine.cpu); err != nil {
+			machine.paused = true
+			return err
+		}
+	}
+	machine.frames++
+
+	var err error
+	if machine.debugger != nil {
+		err = machine.debugger.runFrame(machine.speed)
+	} else {
+		err = machine.cpu.RunFrame(machine.speed)
+	}
+	machine.frame = machine.cpu.Pixels
+	if machine.history != nil {
+		machine.history.Record(machine.cpu)
+	}
+	if fault, ok := err.(*Fault); ok {
+		machine.paused = true
+		machine.notify(fault)
+		return nil
+	}
+	return err
+}
+
+// Sends a fault notification, without blocking the machine if nobody is listening.
+func (machine *Machine) notify(fault *Fault) {
+	select {
+	case machine.faults <- fault:
+	default:
+	}
+}
+
+// Retrieves the channel notified whenever the CPU faults, pausing the machine.
+func (machine *Machine) Faults() <-chan *Fault {
+	return machine.faults
+}
+
+// Enables rewinding through up to the given number of recent frames.
+func (machine *Machine) EnableRewind(frames int) {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.history = NewHistory(frames)
+	machine.history.Record(machine.cpu)
+}
+
+// Notifies the given observer as each frame begins, in addition to any others.
+// An error from the observer pauses the machine, and stops its run loop.
+func (machine *Machine) Observe(observer FrameObserver) {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.observers = append(machine.observers, observer)
+}
+
+// Stops notifying the given observer; once this returns, it won't be notified again.
+func (machine *Machine) Unobserve(observer FrameObserver) {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	observers := machine.observers[:0]
+	for _, other := range machine.observers {
+		if other != observer {
+			observers = append(observers, other)
+		}
+	}
+	machine.observers = observers
+}
+
+// Pauses the machine and returns it to the previous frame.
+// Returns false if rewinding is disabled, or there are no earlier frames left.
+func (machine *Machine) Rewind() bool {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.paused = true
+	if machine.history == nil || !machine.history.Rewind(machine.cpu) {
+		return false
+	}
+	machine.frame = machine.cpu.Pixels
+	return true
+}
+
+// Pauses the machine; the run loop idles until resumed.
+func (machine *Machine) Pause() {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.paused = true
+}
+
+// Resumes the machine after a pause.
+func (machine *Machine) Resume() {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.paused = false
+}
+
+// Determines if the machine is currently paused.
+func (machine *Machine) IsPaused() bool {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	return machine.paused
+}
+
+// Pauses the machine and executes a single instruction.
+// Single instructions aren't frames, so stepping is refused whilst a
+// FrameAccountant is observing.
+func (machine *Machine) Step() error {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.paused = true
+	if err := machine.checkStep(); err != nil {
+		return err
+	}
+	return machine.step()
+}
+
+// Refuses to step single instructions whilst a FrameAccountant is observing.
+// The mutex must be held.
+func (machine *Machine) checkStep() error {
+	for _, observer := range machine.observers {
+		if _, ok := observer.(FrameAccountant); ok {
+			return errors.New("stepping is unavailable whilst every frame is being accounted for")
+		}
+	}
+	return nil
+}
+
+// Executes a single instruction, recording it for rewinding and, with a
+// debugger attached, for reverse stepping and triggers. The mutex must be held.
+func (machine *Machine) step() error {
+	var err error
+	if machine.debugger != nil {
+		err = machine.debugger.step()
+	} else {
+		err = machine.cpu.NextCycle()
+	}
+	machine.frame = machine.cpu.Pixels
+	if err == nil && machine.history != nil {
+		machine.history.Record(machine.cpu)
+	}
+	return err
+}
+
+// Resets the CPU to its initial state and reloads the program.
+// The quirks profile and keypad are preserved. Returns an error if the program
+// can't be reloaded, such as when none was loaded.
+func (machine *Machine) Reset() error {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	machine.cpu.Reset()
+	if err := machine.cpu.LoadProgramWith(machine.program, machine.options); err != nil {
+		return err
+	}
+	machine.frame = machine.cpu.Pixels
+	machine.frames = 0
+	if machine.history != nil {
+		machine.history.Clear()
+		machine.history.Record(machine.cpu)
+	}
+	return nil
+}
+
+// Stops the machine; the run loop returns and cannot be restarted.
+func (machine *Machine) Stop() {
+	machine.stopOnce.Do(func() {
+		close(machine.stop)
+	})
+}
+
+// Retrieves a copy of the most recently completed frame.
+func (machine *Machine) Snapshot() Bitmap {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	return machine.frame
+}
+
+// Runs the given function with exclusive access to the CPU.
+// The run loop is blocked until the function returns.
+func (machine *Machine) Do(fn func(cpu *CPU)) {
+	machine.mutex.Lock()
+	defer machine.mutex.Unlock()
+
+	fn(machine.cpu)
+	machine.frame = machine.cpu.Pixels
+}
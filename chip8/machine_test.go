@@ -0,0 +1,207 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// A small program which counts V0 upwards, drawing a digit each time around.
+var countingProgram = []byte{
+	0x70, 0x01, // ADD V0, 1
+	0xF0, 0x29, // LD F, V0
+	0xD1, 0x15, // DRW V1, V1, 5
+	0x12, 0x00, // JP 0x200
+}
+
+// Asserts that a full session can be driven from another goroutine without racing.
+func TestMachineSession(t *testing.T) {
+	machine := NewMachine(NewCPU(), 10)
+	machine.LoadProgram(countingProgram)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- machine.Run(ctx)
+	}()
+
+	// interact with the machine whilst it runs
+	for i := 0; i < 10; i++ {
+		machine.cpu.Keypad.Press(Keycode(i))
+		frame := machine.Snapshot()
+		frame.GetPixel(0, 0)
+		machine.cpu.Keypad.Release(Keycode(i))
+		time.Sleep(time.Second / FrameRate)
+	}
+
+	machine.Pause()
+	var before, after byte
+	machine.Do(func(cpu *CPU) { before = cpu.V[0] })
+	time.Sleep(3 * time.Second / FrameRate)
+	machine.Do(func(cpu *CPU) { after = cpu.V[0] })
+	if before != after {
+		t.Errorf("V0 changed from %d to %d whilst paused", before, after)
+	}
+
+	if err := machine.Step(); err != nil {
+		t.Fatalf("Unexpected fault: %s", err)
+	}
+	machine.Do(func(cpu *CPU) { assertEquals(t, "PC", cpu.PC, 0x202) })
+
+	if err := machine.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	machine.Do(func(cpu *CPU) {
+		assertEquals(t, "PC", cpu.PC, 0x200)
+		assertEquals(t, "V0", cpu.V[0], 0)
+		assertEquals(t, "M[0x200]", cpu.Memory[0x200], 0x70)
+	})
+	machine.Resume()
+
+	machine.Stop()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected a clean stop, got %s", err)
+	}
+}
+
+// A program which faults once V0 counts up to 3.
+var faultingProgram = []byte{
+	0x70, 0x01, // ADD V0, 1
+	0x40, 0x03, // SNE V0, 3
+	0x00, 0xEE, // RET
+	0x12, 0x00, // JP 0x200
+}
+
+// Asserts that the run loop reports faults to the host, pausing the machine,
+// and carries on running once the machine is reset.
+func TestMachineFault(t *testing.T) {
+	machine := NewMachine(NewCPU(), 10)
+	machine.LoadProgram(faultingProgram)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- machine.Run(ctx)
+	}()
+
+	awaitFault := func() {
+		select {
+		case fault := <-machine.Faults():
+			if fault.Kind != StackUnderflow {
+				t.Fatalf("Expected a stack underflow, got %v", fault)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("The machine never faulted")
+		}
+		if !machine.IsPaused() {
+			t.Error("The machine was not paused by the fault")
+		}
+		machine.Do(func(cpu *CPU) { assertEquals(t, "V0", cpu.V[0], 3) })
+	}
+	awaitFault()
+
+	// the frames run again from the start
+	if err := machine.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	machine.Do(func(cpu *CPU) { assertEquals(t, "V0", cpu.V[0], 0) })
+	machine.Resume()
+	awaitFault()
+	machine.Do(func(cpu *CPU) { assertEquals(t, "PC", cpu.PC, 0x204) })
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Expected the run loop to be cancelled, got %v", err)
+	}
+}
+
+// Asserts that a reset which can't reload a program reports it.
+func TestMachineResetWithoutProgram(t *testing.T) {
+	machine := NewMachine(NewCPU(), 10)
+	if err := machine.Reset(); err == nil {
+		t.Error("Expected resetting without a program to fail")
+	}
+}
+
+// Asserts that stepping the machine records the instruction for rewinding,
+// reverse stepping and the debugger's watchpoints.
+func TestMachineStep(t *testing.T) {
+	machine := NewMachine(NewCPU(), 10)
+	machine.LoadProgram(subroutineProgram)
+	machine.EnableRewind(FrameRate)
+	machine.Step()
+	machine.Step()
+	if !machine.Rewind() {
+		t.Fatal("Expected to rewind")
+	}
+	assertEquals(t, "PC", machine.cpu.PC, 0x208)
+
+	machine, debugger := newDebuggedMachine()
+	machine.Do(func(cpu *CPU) { cpu.I = 0x300 })
+	debugger.Watch(Watchpoint{Address: 0x302, Kind: WatchWrite})
+
+	// CALL, ADD V0, RET, ADD V1, LD B
+	for i := 0; i < 5; i++ {
+		if err := machine.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case stop := <-debugger.Stops():
+		assertStop(t, stop, "watchpoint #302 (write)")
+	default:
+		t.Error("The watchpoint wasn't triggered by stepping")
+	}
+	if err := debugger.ReverseStep(); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "PC", machine.cpu.PC, 0x204)
+	assertEquals(t, "Memory[0x302]", machine.cpu.Memory[0x302], 0)
+
+	// only the observers accounting for every instruction prevent stepping
+	machine.Observe(new(countingObserver))
+	if err := machine.Step(); err != nil {
+		t.Errorf("Unexpected error stepping whilst observed: %s", err)
+	}
+	machine.Observe(NewMovieRecorder(&Movie{}))
+	if err := machine.Step(); err == nil {
+		t.Error("Expected stepping to be refused whilst recording")
+	}
+	if err := debugger.Step(); err == nil {
+		t.Error("Expected the debugger's stepping to be refused whilst recording")
+	}
+}
+
+// Counts the frames it observes.
+type countingObserver struct {
+	frames int
+}
+
+// Counts the frame.
+func (observer *countingObserver) BeginFrame(frame int, cpu *CPU) error {
+	observer.frames++
+	return nil
+}
+
+// Asserts that every observer is notified of each frame until it's removed.
+func TestMachineObservers(t *testing.T) {
+	machine := NewMachine(NewCPU(), 10)
+	machine.LoadProgram(countingProgram)
+	first, second := new(countingObserver), new(countingObserver)
+	machine.Observe(first)
+	machine.Observe(second)
+
+	for i := 0; i < 3; i++ {
+		machine.nextFrame()
+	}
+	machine.Unobserve(first)
+	machine.nextFrame()
+	assertEquals(t, "first", first.frames, 3)
+	assertEquals(t, "second", second.frames, 4)
+}
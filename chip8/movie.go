@@ -0,0 +1,333 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The version of the movie format written by Movie.Write.
+const MovieVersion = 1
+
+// The number of frames between the checksums recorded in a movie.
+const ChecksumInterval = FrameRate
+
+// A recording of a session's input, from power on, which can be replayed to
+// reproduce the session exactly. Everything that influences the emulation is
+// recorded alongside the input.
+type Movie struct {
+	ROM       string     // The SHA-1 hash of the program, in hexadecimal.
+	Seed      int64      // The seed of the random source.
+	Quirks    string     // The name of the quirks profile.
+	Speed     uint       // The number of instructions executed per frame.
+	Address   uint16     // The address the program was loaded at; ProgramStart unless given.
+	Frames    int        // The number of frames recorded.
+	Events    []KeyEvent // The key events, in the order they occurred.
+	Checksums []Checksum // The machine's checksum at regular intervals.
+}
+
+// The checksum of the machine's state at the beginning of a frame.
+type Checksum struct {
+	Frame int
+	Sum   uint32
+}
+
+// Raised when a replay no longer matches the recorded session.
+type DesyncError struct {
+	Frame    int    // The frame at which the replay diverged.
+	Expected uint32 // The recorded checksum.
+	Actual   uint32 // The replayed checksum.
+}
+
+// Describes where the replay diverged.
+func (err *DesyncError) Error() string {
+	return fmt.Sprintf("replay desynchronised at frame %d (checksum %08X; expected %08X)", err.Frame, err.Actual, err.Expected)
+}
+
+// Takes part in each frame the machine runs, before any instructions are executed.
+type FrameObserver interface {
+	// Notifies the given frame is beginning; counting from zero at power on.
+	// Returning an error stops the machine.
+	BeginFrame(frame int, cpu *CPU) error
+}
+
+// A frame observer which accounts for every instruction as part of a frame, as
+// movies do; single instructions can't be stepped whilst one is observing.
+type FrameAccountant interface {
+	FrameObserver
+	// Marks the observer as accounting for every instruction.
+	AccountsForInstructions()
+}
+
+// Computes the SHA-1 hash of a program, in hexadecimal.
+func HashProgram(program []byte) string {
+	hash := sha1.Sum(program)
+	return hex.EncodeToString(hash[:])
+}
+
+// Writes the movie in its text format; a header followed by a line per event
+// and checksum, e.g.
+//
+//	chip8-movie 1
+//	rom 0f0ca5b2c71ad2a4c1a4e2ac28d3b3e9e9c5a1d3
+//	seed 1
+//	quirks modern
+//	speed 10
+//	address 200
+//	frames 600
+//	sync 0 1A2B3C4D
+//	press 42 5
+//	release 47 5
+func (movie *Movie) Write(writer io.Writer) error {
+	buffered := bufio.NewWriter(writer)
+	fmt.Fprintf(buffered, "chip8-movie %d\n", MovieVersion)
+	fmt.Fprintf(buffered, "rom %s\nseed %d\nquirks %s\nspeed %d\naddress %03X\nframes %d\n",
+		movie.ROM, movie.Seed, movie.Quirks, movie.Speed, movie.Address, movie.Frames)
+
+	// interleave the checksums and events by frame, checksums first
+	events, checksums := movie.Events, movie.Checksums
+	for len(events) > 0 || len(checksums) > 0 {
+		if len(checksums) > 0 && (len(events) == 0 || checksums[0].Frame <= events[0].Frame) {
+			fmt.Fprintf(buffered, "sync %d %08X\n", checksums[0].Frame, checksums[0].Sum)
+			checksums = checksums[1:]
+			continue
+		}
+		action := "release"
+		if events[0].Pressed {
+			action = "press"
+		}
+		fmt.Fprintf(buffered, "%s %d %X\n", action, events[0].Frame, events[0].Key)
+		events = events[1:]
+	}
+	return buffered.Flush()
+}
+
+// Reads a movie previously written by Movie.Write.
+func ReadMovie(reader io.Reader) (*Movie, error) {
+	scanner := bufio.NewScanner(reader)
+	if !scanner.Scan() || scanner.Text() != fmt.Sprintf("chip8-movie %d", MovieVersion) {
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("not a chip8 movie, or an unsupported version")
+	}
+
+	// movies recorded before the load address could be chosen omit it
+	movie := &Movie{Address: ProgramStart}
+	for line := 2; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		err := movie.parse(fields)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return movie, nil
+}
+
+// Parses a single line of a movie into the movie.
+func (movie *Movie) parse(fields []string) error {
+	expect := func(count int) error {
+		if len(fields) != count {
+			return fmt.Errorf("%s expects %d values", fields[0], count-1)
+		}
+		return nil
+	}
+	frame := func(text string) (int, error) {
+		value, err := strconv.Atoi(text)
+		if err != nil || value < 0 {
+			return 0, fmt.Errorf("invalid frame %s", text)
+		}
+		return value, nil
+	}
+
+	var err error
+	switch fields[0] {
+	case "rom":
+		if err = expect(2); err == nil {
+			movie.ROM = fields[1]
+		}
+	case "seed":
+		if err = expect(2); err == nil {
+			movie.Seed, err = strconv.ParseInt(fields[1], 10, 64)
+		}
+	case "quirks":
+		if err = expect(2); err == nil {
+			movie.Quirks = fields[1]
+		}
+	case "speed":
+		if err = expect(2); err == nil {
+			var speed uint64
+			speed, err = strconv.ParseUint(fields[1], 10, 32)
+			movie.Speed = uint(speed)
+		}
+	case "address":
+		if err = expect(2); err == nil {
+			var address uint64
+			if address, err = strconv.ParseUint(fields[1], 16, 16); err != nil {
+				err = fmt.Errorf("invalid address %s", fields[1])
+			}
+			movie.Address = uint16(address)
+		}
+	case "frames":
+		if err = expect(2); err == nil {
+			movie.Frames, err = frame(fields[1])
+		}
+	case "sync":
+		if err = expect(3); err != nil {
+			return err
+		}
+		var checksum Checksum
+		if checksum.Frame, err = frame(fields[1]); err != nil {
+			return err
+		}
+		sum, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid checksum %s", fields[2])
+		}
+		checksum.Sum = uint32(sum)
+		movie.Checksums = append(movie.Checksums, checksum)
+	case "press", "release":
+		if err = expect(3); err != nil {
+			return err
+		}
+		event := KeyEvent{Pressed: fields[0] == "press"}
+		if event.Frame, err = frame(fields[1]); err != nil {
+			return err
+		}
+		key, err := strconv.ParseUint(fields[2], 16, 8)
+		if err != nil || key >= KeyCount {
+			return fmt.Errorf("invalid key %s", fields[2])
+		}
+		event.Key = Keycode(key)
+		movie.Events = append(movie.Events, event)
+	default:
+		return fmt.Errorf("unknown entry %s", fields[0])
+	}
+	return err
+}
+
+// Records a movie of the input to a machine.
+//
+// The recorder decorates the keypad; host input is passed to it instead, and
+// reaches the keypad at the beginning of the following frame, so that each
+// event falls on a frame boundary and can be replayed identically.
+type MovieRecorder struct {
+	movie   *Movie     // The movie being recorded.
+	pending []KeyEvent // The events awaiting the next frame.
+	mutex   sync.Mutex // Guards the above; input arrives from the host whilst the machine runs.
+}
+
+// Builds a new recorder, recording into the given movie.
+// The movie's header should be filled in by the caller.
+func NewMovieRecorder(movie *Movie) *MovieRecorder {
+	return &MovieRecorder{movie: movie}
+}
+
+// Queues a key press for the next frame.
+func (recorder *MovieRecorder) Press(key Keycode) {
+	recorder.queue(KeyEvent{Key: key, Pressed: true})
+}
+
+// Queues a key release for the next frame.
+func (recorder *MovieRecorder) Release(key Keycode) {
+	recorder.queue(KeyEvent{Key: key})
+}
+
+// Queues a key event for the next frame; keys outside of the keypad's range are ignored.
+func (recorder *MovieRecorder) queue(event KeyEvent) {
+	if int(event.Key) >= KeyCount {
+		return
+	}
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.pending = append(recorder.pending, event)
+}
+
+// Passes the queued events to the keypad, recording them and the checksum of the frame.
+func (recorder *MovieRecorder) BeginFrame(frame int, cpu *CPU) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	movie := recorder.movie
+	if frame%ChecksumInterval == 0 {
+		movie.Checksums = append(movie.Checksums, Checksum{Frame: frame, Sum: cpu.Checksum()})
+	}
+	for _, event := range recorder.pending {
+		event.Frame = frame
+		event.apply(cpu.Keypad)
+		movie.Events = append(movie.Events, event)
+	}
+	recorder.pending = recorder.pending[:0]
+	movie.Frames = frame + 1
+	return nil
+}
+
+// Marks the recorder as accounting for every instruction, as the movie's frames must.
+func (recorder *MovieRecorder) AccountsForInstructions() {}
+
+// Replays a movie's input into a machine, verifying the machine's checksums as it goes.
+type MoviePlayer struct {
+	movie     *Movie     // The movie being replayed.
+	events    int        // The index of the next event.
+	checksums int        // The index of the next checksum.
+	finished  bool       // Whether every recorded frame has been replayed.
+	mutex     sync.Mutex // Guards the above; the host polls for the end of the replay whilst the machine runs.
+}
+
+// Builds a new player for the given movie.
+func NewMoviePlayer(movie *Movie) *MoviePlayer {
+	return &MoviePlayer{movie: movie}
+}
+
+// Verifies the frame's checksum, if one was recorded, then feeds the recorded events to the keypad.
+// Returns a *DesyncError if the checksum does not match.
+func (player *MoviePlayer) BeginFrame(frame int, cpu *CPU) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	movie := player.movie
+	for ; player.checksums < len(movie.Checksums) && movie.Checksums[player.checksums].Frame <= frame; player.checksums++ {
+		checksum := movie.Checksums[player.checksums]
+		if actual := cpu.Checksum(); checksum.Frame == frame && actual != checksum.Sum {
+			return &DesyncError{Frame: frame, Expected: checksum.Sum, Actual: actual}
+		}
+	}
+	for ; player.events < len(movie.Events) && movie.Events[player.events].Frame <= frame; player.events++ {
+		event := movie.Events[player.events]
+		if event.Frame == frame {
+			event.apply(cpu.Keypad)
+		}
+	}
+	if frame+1 >= movie.Frames {
+		player.finished = true
+	}
+	return nil
+}
+
+// Marks the player as accounting for every instruction, as the movie's frames must.
+func (player *MoviePlayer) AccountsForInstructions() {}
+
+// Determines if every recorded frame has been replayed.
+func (player *MoviePlayer) Finished() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	return player.finished
+}
@@ -0,0 +1,105 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// A program whose state depends on both its input and random numbers.
+var inputProgram = []byte{
+	0xF0, 0x0A, // 200: LD V0, K
+	0xC1, 0xFF, // 202: RND V1, #FF
+	0x82, 0x04, // 204: ADD V2, V0
+	0x12, 0x00, // 206: JP 200
+}
+
+// Builds a machine running the input program with the given seed.
+func newMovieMachine(seed int64) *Machine {
+	cpu := NewCPU()
+	cpu.Random = NewRandomSource(seed)
+	machine := NewMachine(cpu, 10)
+	machine.LoadProgram(inputProgram)
+	return machine
+}
+
+// Runs the given number of frames, failing the test on any error.
+func runFrames(t *testing.T, machine *Machine, frames int) {
+	for i := 0; i < frames; i++ {
+		if err := machine.nextFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Asserts that a recorded session replays to exactly the same state, via the movie file.
+func TestMovieReplay(t *testing.T) {
+	movie := &Movie{ROM: HashProgram(inputProgram), Seed: 7, Quirks: "modern", Speed: 10, Address: ProgramStart}
+	recorder := NewMovieRecorder(movie)
+	machine := newMovieMachine(7)
+	machine.Observe(recorder)
+
+	for _, key := range []Keycode{3, 9, 3, 0xF} {
+		runFrames(t, machine, 50)
+		recorder.Press(key)
+		runFrames(t, machine, 3)
+		recorder.Release(key)
+	}
+	runFrames(t, machine, 120)
+	expected := machine.cpu.Checksum()
+	assertEquals(t, "V2", machine.cpu.V[2], 3+9+3+0xF)
+
+	var file bytes.Buffer
+	if err := movie.Write(&file); err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := ReadMovie(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replayed, movie) {
+		t.Fatalf("Read back\n%+v\nexpected\n%+v", replayed, movie)
+	}
+
+	player := NewMoviePlayer(replayed)
+	machine = newMovieMachine(replayed.Seed)
+	machine.Observe(player)
+	runFrames(t, machine, replayed.Frames)
+	if !player.Finished() {
+		t.Error("Expected the replay to have finished")
+	}
+	if machine.cpu.Checksum() != expected {
+		t.Error("The replay finished in a different state")
+	}
+}
+
+// Asserts that a replay with a different outcome fails at the first checksum after diverging.
+func TestMovieDesync(t *testing.T) {
+	movie := &Movie{Seed: 7}
+	recorder := NewMovieRecorder(movie)
+	machine := newMovieMachine(7)
+	machine.Observe(recorder)
+	recorder.Press(5)
+	runFrames(t, machine, 3*ChecksumInterval)
+
+	// replaying without the key press leaves the program waiting
+	movie.Events = nil
+	machine = newMovieMachine(7)
+	machine.Observe(NewMoviePlayer(movie))
+	var err error
+	for frame := 0; frame < movie.Frames && err == nil; frame++ {
+		err = machine.nextFrame()
+	}
+	desync, ok := err.(*DesyncError)
+	if !ok {
+		t.Fatalf("Expected a desync; got %v", err)
+	}
+	assertEquals(t, "frame", desync.Frame, ChecksumInterval)
+	if !machine.IsPaused() {
+		t.Error("A desync should pause the machine")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+// Selects between the contested interpretations of ambiguous instructions,
+// along with the memory extent of the platform that introduced them.
+// Different Chip 8 implementations disagree on these, and programs were
+// typically written against one particular implementation.
+// See https://chip-8.github.io/extensions/ for a history of the variations.
+type Quirks struct {
+	ShiftUsesVy   bool // 8xy6/8xyE shift Vy and store the result in Vx, rather than shifting Vx in place.
+	MemoryMovesI  bool // Fx55/Fx65 leave I pointing past the last register transferred.
+	JumpUsesVx    bool // Bnnn jumps to nnn + Vx (where x is the high nibble of nnn), rather than nnn + V0.
+	LogicResetsVF bool // 8xy1/8xy2/8xy3 reset VF to zero.
+	ClipSprites   bool // Sprites are clipped at the edges of the display, rather than wrapping around.
+	LargeMemory   bool // Memory extends to 64K, as on XO-CHIP, rather than 4K.
+}
+
+var (
+	// The original COSMAC VIP interpreter.
+	VIPQuirks = Quirks{
+		ShiftUsesVy:   true,
+		MemoryMovesI:  true,
+		LogicResetsVF: true,
+		ClipSprites:   true,
+	}
+	// The CHIP-48 interpreter for the HP-48 calculators.
+	Chip48Quirks = Quirks{
+		MemoryMovesI: true,
+		JumpUsesVx:   true,
+		ClipSprites:  true,
+	}
+	// The SUPER-CHIP 1.1 interpreter for the HP-48 calculators.
+	SuperChipQuirks = Quirks{
+		JumpUsesVx:  true,
+		ClipSprites: true,
+	}
+	// The XO-CHIP extensions, as implemented by Octo.
+	XOChipQuirks = Quirks{
+		ShiftUsesVy:  true,
+		MemoryMovesI: true,
+		LargeMemory:  true,
+	}
+	// The behaviour most modern interpreters (and this one, by default) settle on.
+	ModernQuirks = Quirks{}
+)
+
+// The named quirks profiles, as selectable by the host.
+var QuirksProfiles = map[string]Quirks{
+	"vip":    VIPQuirks,
+	"chip48": Chip48Quirks,
+	"schip":  SuperChipQuirks,
+	"xochip": XOChipQuirks,
+	"modern": ModernQuirks,
+}
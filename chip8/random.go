@@ -0,0 +1,54 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+// The source of the random numbers drawn by the RND instruction.
+// Each CPU owns its own source, so that a run may be reproduced exactly.
+type RandomSource interface {
+	RandomByte() byte // Draws the next random number, across the full range of 0 to 255.
+}
+
+// A random source whose state may be captured, so that save states, rewinding
+// and replays continue the same sequence of numbers.
+type StatefulRandomSource interface {
+	RandomSource
+	State() uint64         // Retrieves the current state of the source.
+	SetState(state uint64) // Restores a state previously retrieved from the source.
+}
+
+// The default random source; a xorshift64* generator.
+// It is fast, has a small state, and its sequence is fully determined by its seed.
+type XorShiftSource struct {
+	state uint64 // Never zero, which would only ever produce zeroes.
+}
+
+// Builds a new random source with the given seed.
+func NewRandomSource(seed int64) *XorShiftSource {
+	source := &XorShiftSource{}
+	source.SetState(uint64(seed))
+	return source
+}
+
+// Draws the next random number, from the high bits of the generator's output.
+func (source *XorShiftSource) RandomByte() byte {
+	source.state ^= source.state >> 12
+	source.state ^= source.state << 25
+	source.state ^= source.state >> 27
+	return byte((source.state * 0x2545F4914F6CDD1D) >> 56)
+}
+
+// Retrieves the current state of the generator.
+func (source *XorShiftSource) State() uint64 {
+	return source.state
+}
+
+// Restores a state previously retrieved from the generator.
+// The zero state is replaced by an arbitrary fixed one.
+func (source *XorShiftSource) SetState(state uint64) {
+	if state == 0 {
+		state = 0x9E3779B97F4A7C15
+	}
+	source.state = state
+}
@@ -0,0 +1,39 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import "testing"
+
+// A random source which always draws the same number.
+type fixedRandom byte
+
+// Draws the fixed number.
+func (random fixedRandom) RandomByte() byte {
+	return byte(random)
+}
+
+// Asserts that sources with the same seed or state draw the same sequence.
+func TestRandomSource(t *testing.T) {
+	first, second := NewRandomSource(42), NewRandomSource(42)
+	seen := make(map[byte]bool)
+	for i := 0; i < 4096; i++ {
+		value := first.RandomByte()
+		assertEquals(t, "draw", second.RandomByte(), value)
+		seen[value] = true
+	}
+	assertEquals(t, "distinct values", len(seen), 256)
+
+	// restoring a state continues from the same point
+	state := first.State()
+	expected := first.RandomByte()
+	second.SetState(state)
+	assertEquals(t, "restored draw", second.RandomByte(), expected)
+
+	// a zero seed still produces numbers
+	zero := NewRandomSource(0)
+	if zero.RandomByte() == 0 && zero.RandomByte() == 0 {
+		t.Error("A zero seed should not get stuck at zero")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import "bytes"
+
+// The granularity at which memory and pixels are compared between recordings, in bytes.
+const patchSize = 64
+
+// The previous content of a changed range of memory or pixels.
+type patch struct {
+	offset int
+	data   []byte
+}
+
+// The changes needed to take the machine back to an earlier recording.
+type delta struct {
+	registers registerState // The earlier registers, which are small enough to keep whole.
+	random    uint64        // The earlier state of the random source.
+	memory    []patch       // The earlier content of the memory which has since changed.
+	pixels    []patch       // The earlier content of the pixels which have since changed.
+}
+
+// A bounded history of machine states, for stepping backwards through a session.
+// Only the differences between consecutive recordings are kept, in a ring buffer;
+// once full, the oldest are forgotten.
+//
+// The keypad is not part of the history; rewinding leaves the host's keys alone.
+type History struct {
+	deltas    []delta                        // The ring buffer of deltas, each undoing a recording.
+	next      int                            // The index at which the next delta is stored.
+	count     int                            // The number of deltas stored.
+	recorded  bool                           // Whether anything has been recorded yet.
+	memory    [65536]byte                    // The memory at the most recent recording.
+	pixels    [HiResWidth * HiResHeight]byte // The pixels at the most recent recording.
+	registers registerState                  // The registers at the most recent recording.
+	random    uint64                         // The state of the random source at the most recent recording.
+}
+
+// Builds a new history, remembering up to the given number of earlier states.
+func NewHistory(capacity int) *History {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &History{deltas: make([]delta, capacity)}
+}
+
+// Retrieves the number of earlier states that can be returned to.
+func (history *History) Len() int {
+	return history.count
+}
+
+// Forgets everything recorded.
+func (history *History) Clear() {
+	for i := range history.deltas {
+		history.deltas[i] = delta{}
+	}
+	history.next, history.count, history.recorded = 0, 0, false
+}
+
+// Records the current state of the CPU.
+// The first recording establishes where the history begins.
+func (history *History) Record(cpu *CPU) {
+	registers, random := cpu.captureRegisters(), cpu.randomState()
+	if !history.recorded {
+		history.memory = cpu.Memory
+		history.pixels = cpu.Pixels.pixels
+		history.registers, history.random = registers, random
+		history.recorded = true
+		return
+	}
+
+	history.deltas[history.next] = delta{
+		registers: history.registers,
+		random:    history.random,
+		memory:    diff(history.memory[:cpu.memorySize()], cpu.Memory[:]),
+		pixels:    diff(history.pixels[:], cpu.Pixels.pixels[:]),
+	}
+	history.registers, history.random = registers, random
+	history.next = (history.next + 1) % len(history.deltas)
+	if history.count < len(history.deltas) {
+		history.count++
+	}
+}
+
+// Returns the CPU to the state before the most recent recording, forgetting it.
+// Anything which happened since that recording is discarded too.
+// Returns false if there is no earlier state to return to.
+func (history *History) Rewind(cpu *CPU) bool {
+	if history.count == 0 {
+		return false
+	}
+	history.next = (history.next + len(history.deltas) - 1) % len(history.deltas)
+	undo := history.deltas[history.next]
+	history.deltas[history.next] = delta{}
+	history.count--
+
+	for _, patch := range undo.memory {
+		copy(history.memory[patch.offset:], patch.data)
+	}
+	for _, patch := range undo.pixels {
+		copy(history.pixels[patch.offset:], patch.data)
+	}
+	history.registers, history.random = undo.registers, undo.random
+
+	cpu.Memory = history.memory
+	cpu.Pixels.pixels = history.pixels
+	cpu.restoreRegisters(history.registers)
+	cpu.restoreRandomState(history.random)
+	return true
+}
+
+// Compares the previous content against the current, returning patches of the
+// previous content wherever it differs. The previous content is brought up to date.
+func diff(previous, current []byte) []patch {
+	var patches []patch
+	for offset := 0; offset < len(previous); offset += patchSize {
+		end := offset + patchSize
+		if end > len(previous) {
+			end = len(previous)
+		}
+		if bytes.Equal(previous[offset:end], current[offset:end]) {
+			continue
+		}
+
+		// extend the last patch if it ends where this one begins
+		if last := len(patches) - 1; last >= 0 && patches[last].offset+len(patches[last].data) == offset {
+			patches[last].data = append(patches[last].data, previous[offset:end]...)
+		} else {
+			patches = append(patches, patch{offset: offset, data: append([]byte(nil), previous[offset:end]...)})
+		}
+		copy(previous[offset:end], current[offset:end])
+	}
+	return patches
+}
@@ -0,0 +1,70 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import "testing"
+
+// Asserts that rewinding returns the machine to each earlier frame in turn.
+func TestRewind(t *testing.T) {
+	machine := NewMachine(NewCPU(), 1)
+	machine.LoadProgram(countingProgram)
+	if machine.Rewind() {
+		t.Error("Expected rewinding to fail whilst disabled")
+	}
+	machine.EnableRewind(3)
+	machine.Resume()
+
+	// record each frame as it completes
+	var frames []CPU
+	for i := 0; i < 5; i++ {
+		frames = append(frames, *machine.cpu)
+		if err := machine.nextFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// only the last three frames were retained
+	for i := 4; i >= 2; i-- {
+		if !machine.Rewind() {
+			t.Fatalf("Expected to rewind to frame %d", i)
+		}
+		if *machine.cpu != frames[i] {
+			t.Errorf("The CPU differs from frame %d after rewinding", i)
+		}
+		if machine.Snapshot() != frames[i].Pixels {
+			t.Errorf("The display differs from frame %d after rewinding", i)
+		}
+	}
+	if machine.Rewind() {
+		t.Error("Expected the history to be exhausted")
+	}
+	if !machine.IsPaused() {
+		t.Error("Rewinding should pause the machine")
+	}
+}
+
+// Asserts that only the changed regions of memory are kept between recordings.
+func TestHistoryDeltas(t *testing.T) {
+	cpu := NewCPU()
+	history := NewHistory(10)
+	history.Record(cpu)
+
+	cpu.Memory[0x300] = 1
+	cpu.Memory[0x301] = 2
+	cpu.Memory[0x340] = 3
+	cpu.Memory[0x400] = 4
+	history.Record(cpu)
+
+	patches := history.deltas[0].memory
+	assertEquals(t, "patches", len(patches), 2)
+	assertEquals(t, "patch 0 offset", patches[0].offset, 0x300)
+	assertEquals(t, "patch 0 length", len(patches[0].data), 2*patchSize)
+	assertEquals(t, "patch 1 offset", patches[1].offset, 0x400)
+	assertEquals(t, "pixel patches", len(history.deltas[0].pixels), 0)
+
+	history.Rewind(cpu)
+	assertEquals(t, "Memory[0x340]", cpu.Memory[0x340], 0)
+	assertEquals(t, "Len", history.Len(), 0)
+}
@@ -0,0 +1,127 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The details and recommended settings of a known program.
+// Any of the settings may be omitted, leaving the emulator's own defaults.
+type ROMInfo struct {
+	Title    string            `json:"title"`
+	Authors  []string          `json:"authors,omitempty"`
+	Platform string            `json:"platform,omitempty"` // The system the program was written for, e.g. chip8, chip48, schip or xochip.
+	Tickrate uint              `json:"tickrate,omitempty"` // The number of instructions to execute per frame.
+	Quirks   string            `json:"quirks,omitempty"`   // The name of the quirks profile the program expects.
+	Palette  string            `json:"palette,omitempty"`  // The colours to display in; see ParsePalette.
+	Keys     map[string]string `json:"keys,omitempty"`     // What each of the keys used does, by hexadecimal key.
+	Layout   string            `json:"layout,omitempty"`   // The name of the preset keymap to play with; see Layouts.
+	Keymap   map[string]string `json:"keymap,omitempty"`   // Host keys to map onto the keypad in addition to the layout; see ParseKeymap.
+	Gamepad  map[string]string `json:"gamepad,omitempty"`  // Gamepad inputs to remap from the default; see ParseGamepadMapping.
+}
+
+// A database of known programs, keyed by the SHA-1 hash of their contents in
+// lowercase hexadecimal; as computed by HashProgram. For example,
+//
+//	{
+//	  "f13766c14aeb02ad8d4d103cb5eadd282d20cddc": {
+//	    "title": "Brix",
+//	    "authors": ["Andreas Gustafsson"],
+//	    "platform": "chip48",
+//	    "tickrate": 10,
+//	    "keys": {"4": "left", "6": "right"},
+//	    "keymap": {"Left": "4", "Right": "6"},
+//	    "gamepad": {"dpleft": "4", "dpright": "6"}
+//	  }
+//	}
+type ROMDatabase map[string]ROMInfo
+
+// Reads and validates a database in its JSON format.
+func ReadROMDatabase(reader io.Reader) (ROMDatabase, error) {
+	var database ROMDatabase
+	if err := json.NewDecoder(reader).Decode(&database); err != nil {
+		return nil, err
+	}
+	for hash, info := range database {
+		if err := info.validate(hash); err != nil {
+			return nil, err
+		}
+	}
+	return database, nil
+}
+
+// Retrieves the details of the given program, if it's known.
+func (database ROMDatabase) Lookup(program []byte) (ROMInfo, bool) {
+	info, ok := database[HashProgram(program)]
+	return info, ok
+}
+
+// Describes the program by its title, authors and platform.
+func (info ROMInfo) String() string {
+	description := info.Title
+	if len(info.Authors) > 0 {
+		description += " by " + strings.Join(info.Authors, ", ")
+	}
+	if info.Platform != "" {
+		description += " (" + info.Platform + ")"
+	}
+	return description
+}
+
+// Describes what each of the program's keys does, in order of key, e.g. "4: left, 6: right".
+func (info ROMInfo) KeyHints() string {
+	keys := make([]string, 0, len(info.Keys))
+	for key := range info.Keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hints := make([]string, len(keys))
+	for i, key := range keys {
+		hints[i] = strings.ToUpper(key) + ": " + info.Keys[key]
+	}
+	return strings.Join(hints, ", ")
+}
+
+// Ensures the entry's hash and settings are usable.
+func (info ROMInfo) validate(hash string) error {
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != 20 || hash != strings.ToLower(hash) {
+		return fmt.Errorf("invalid SHA-1 hash %s; expected 40 lowercase hexadecimal digits", hash)
+	}
+	if info.Quirks != "" {
+		if _, ok := QuirksProfiles[info.Quirks]; !ok {
+			return fmt.Errorf("%s: unknown quirks profile %s", hash, info.Quirks)
+		}
+	}
+	if info.Palette != "" {
+		if _, err := ParsePalette(info.Palette); err != nil {
+			return fmt.Errorf("%s: %v", hash, err)
+		}
+	}
+	if info.Layout != "" {
+		if _, ok := Layouts[info.Layout]; !ok {
+			return fmt.Errorf("%s: unknown layout %s", hash, info.Layout)
+		}
+	}
+	if _, err := ParseKeymap(info.Keymap); err != nil {
+		return fmt.Errorf("%s: %v", hash, err)
+	}
+	if _, err := ParseGamepadMapping(info.Gamepad); err != nil {
+		return fmt.Errorf("%s: %v", hash, err)
+	}
+	for key := range info.Keys {
+		if value, err := strconv.ParseUint(key, 16, 8); err != nil || value >= KeyCount {
+			return fmt.Errorf("%s: invalid key %s", hash, key)
+		}
+	}
+	return nil
+}
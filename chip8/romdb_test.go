@@ -0,0 +1,73 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Asserts the bundled database is valid, and knows every bundled program.
+func TestBundledROMDatabase(t *testing.T) {
+	file, err := os.Open("../programs/roms.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	database, err := ReadROMDatabase(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range GoldenTests {
+		program, err := ioutil.ReadFile(filepath.Join("../programs", test.Program))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, ok := database.Lookup(program); !ok || info.Title == "" {
+			t.Errorf("%s is missing from the database", test.Program)
+		}
+	}
+}
+
+// Asserts invalid entries are rejected.
+func TestInvalidROMDatabase(t *testing.T) {
+	const hash = `"f13766c14aeb02ad8d4d103cb5eadd282d20cddc"`
+	tests := map[string]string{
+		"short hash":     `{"f13766c1": {"title": "Brix"}}`,
+		"uppercase hash": `{"F13766C14AEB02AD8D4D103CB5EADD282D20CDDC": {"title": "Brix"}}`,
+		"quirks":         `{` + hash + `: {"title": "Brix", "quirks": "cosmac"}}`,
+		"palette":        `{` + hash + `: {"title": "Brix", "palette": "000000,FFFFFF"}}`,
+		"key":            `{` + hash + `: {"title": "Brix", "keys": {"10": "left"}}}`,
+		"layout":         `{` + hash + `: {"title": "Brix", "layout": "dvorak"}}`,
+		"keymap":         `{` + hash + `: {"title": "Brix", "keymap": {"Left": "G"}}}`,
+		"gamepad":        `{` + hash + `: {"title": "Brix", "gamepad": {"lefty": "4"}}}`,
+		"syntax":         `{` + hash + `: {"title": "Brix"`,
+	}
+	for name, text := range tests {
+		if _, err := ReadROMDatabase(strings.NewReader(text)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Asserts the description and key hints of an entry.
+func TestROMInfo(t *testing.T) {
+	info := ROMInfo{
+		Title:    "Pong",
+		Authors:  []string{"Paul Vervalin"},
+		Platform: "chip48",
+		Keys:     map[string]string{"c": "right up", "1": "left up", "4": "left down"},
+	}
+	if description := info.String(); description != "Pong by Paul Vervalin (chip48)" {
+		t.Errorf("Description was %q", description)
+	}
+	if hints := info.KeyHints(); hints != "1: left up, 4: left down, C: right up" {
+		t.Errorf("Key hints were %q", hints)
+	}
+}
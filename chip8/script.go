@@ -0,0 +1,88 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A key press or release, on the frame it occurs.
+type KeyEvent struct {
+	Frame   int     // The frame the event occurs before, counting from zero.
+	Key     Keycode // The key pressed or released.
+	Pressed bool    // Whether the key was pressed, rather than released.
+}
+
+// A scripted sequence of key events, ordered by frame.
+type KeyScript []KeyEvent
+
+// Parses a key script; a sequence of events separated by whitespace, commas or
+// new lines, each of which is one of:
+//
+//	60+5  press key 5 before frame 60
+//	90-5  release key 5 before frame 90
+//	60:5  tap key 5; press it before frame 60 and release it before frame 61
+//
+// Frames are decimal and keys hexadecimal. Anything following a # on a line is ignored.
+func ParseKeyScript(text string) (KeyScript, error) {
+	var script KeyScript
+	for _, line := range strings.Split(text, "\n") {
+		if comment := strings.IndexByte(line, '#'); comment >= 0 {
+			line = line[:comment]
+		}
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' }) {
+			separator := strings.IndexAny(field, "+-:")
+			if separator <= 0 {
+				return nil, fmt.Errorf("invalid key event %s; expected <frame>+<key>, <frame>-<key> or <frame>:<key>", field)
+			}
+			frame, err := strconv.Atoi(field[:separator])
+			if err != nil || frame < 0 {
+				return nil, fmt.Errorf("invalid frame in key event %s", field)
+			}
+			key, err := strconv.ParseUint(field[separator+1:], 16, 8)
+			if err != nil || key >= KeyCount {
+				return nil, fmt.Errorf("invalid key in key event %s", field)
+			}
+
+			switch field[separator] {
+			case '+':
+				script = append(script, KeyEvent{Frame: frame, Key: Keycode(key), Pressed: true})
+			case '-':
+				script = append(script, KeyEvent{Frame: frame, Key: Keycode(key)})
+			case ':':
+				script = append(script,
+					KeyEvent{Frame: frame, Key: Keycode(key), Pressed: true},
+					KeyEvent{Frame: frame + 1, Key: Keycode(key)})
+			}
+		}
+	}
+
+	// events on the same frame keep their written order
+	sort.SliceStable(script, func(i, j int) bool { return script[i].Frame < script[j].Frame })
+	return script, nil
+}
+
+// Feeds the events occurring before the given frame to the input.
+func (script KeyScript) Play(frame int, input KeyInput) {
+	start := sort.Search(len(script), func(i int) bool { return script[i].Frame >= frame })
+	for _, event := range script[start:] {
+		if event.Frame != frame {
+			break
+		}
+		event.apply(input)
+	}
+}
+
+// Presses or releases the event's key on the input.
+func (event KeyEvent) apply(input KeyInput) {
+	if event.Pressed {
+		input.Press(event.Key)
+	} else {
+		input.Release(event.Key)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Asserts that key scripts parse into events ordered by frame.
+func TestParseKeyScript(t *testing.T) {
+	script, err := ParseKeyScript("10:a, 5+1\n# a comment\n  20-1 # another\n5+2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := KeyScript{
+		{Frame: 5, Key: 0x1, Pressed: true},
+		{Frame: 5, Key: 0x2, Pressed: true},
+		{Frame: 10, Key: 0xA, Pressed: true},
+		{Frame: 11, Key: 0xA},
+		{Frame: 20, Key: 0x1},
+	}
+	if !reflect.DeepEqual(script, expected) {
+		t.Errorf("Parsed %v; expected %v", script, expected)
+	}
+
+	for _, invalid := range []string{"10", "+1", "x+1", "10+10", "10*1", "-1+1"} {
+		if _, err := ParseKeyScript(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// Asserts that a headless run feeds the script to the program.
+func TestRunFrames(t *testing.T) {
+	cpu := NewCPU()
+	cpu.LoadProgram([]byte{
+		0xF0, 0x0A, // 200: LD V0, K
+		0x00, 0xFD, // 202: EXIT
+	})
+	script, _ := ParseKeyScript("3:7")
+
+	frames, err := cpu.RunFrames(100, 10, script, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "frames", frames, 5)
+	assertEquals(t, "V0", cpu.V[0], 0x7)
+	assertEquals(t, "key 7", cpu.Keypad.IsPressed(0x7), false)
+}
@@ -0,0 +1,240 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The version of the save state format written by SaveState.
+// This increases whenever the layout changes; older states remain loadable where possible.
+const StateVersion = 2
+
+// Identifies a save state file.
+var stateMagic = [4]byte{'C', '8', 'S', 'T'}
+
+// Raised when loading something which is not a save state.
+var ErrNotState = errors.New("not a chip8 save state")
+
+// Leads every save state, identifying the format and its version.
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+}
+
+// The layout of a version 1 save state, following the header.
+// Everything is written big-endian, with booleans as a single byte.
+type stateV1 struct {
+	Memory  [65536]byte
+	V       [16]byte
+	I       uint16
+	PC      uint16
+	SP      byte
+	Stack   [12]uint16
+	DT, ST  byte
+	Keys    [KeyCount]bool
+	Pixels  [HiResWidth * HiResHeight]byte
+	HiRes   bool
+	Flags   [16]byte
+	Exited  bool
+	Planes  byte
+	Pattern [16]byte
+	Pitch   byte
+	KeyWait KeyWait
+}
+
+// The layout of a version 2 save state, which groups the registers after the
+// pixels and adds the random source.
+type stateV2 struct {
+	Memory    [65536]byte
+	Pixels    [HiResWidth * HiResHeight]byte
+	Registers registerState
+	Random    uint64 // The state of the random source, or zero if it has none.
+}
+
+// Upgrades a version 1 state to version 2, without a random source.
+func (state *stateV1) upgrade() *stateV2 {
+	return &stateV2{
+		Memory: state.Memory,
+		Pixels: state.Pixels,
+		Registers: registerState{
+			V:       state.V,
+			I:       state.I,
+			PC:      state.PC,
+			SP:      state.SP,
+			Stack:   state.Stack,
+			DT:      state.DT,
+			ST:      state.ST,
+			Keys:    state.Keys,
+			HiRes:   state.HiRes,
+			Flags:   state.Flags,
+			Exited:  state.Exited,
+			Planes:  state.Planes,
+			Pattern: state.Pattern,
+			Pitch:   state.Pitch,
+			KeyWait: state.KeyWait,
+		},
+	}
+}
+
+// Everything in the machine state besides memory and pixels.
+type registerState struct {
+	V       [16]byte
+	I       uint16
+	PC      uint16
+	SP      byte
+	Stack   [12]uint16
+	DT, ST  byte
+	Keys    [KeyCount]bool
+	HiRes   bool
+	Flags   [16]byte
+	Exited  bool
+	Planes  byte
+	Pattern [16]byte
+	Pitch   byte
+	KeyWait KeyWait
+}
+
+// Writes a snapshot of the entire machine state to the given writer.
+// The quirks profile, keypad and watcher are configuration rather than state, and are not saved.
+//
+// The state of the random source is saved if it is a StatefulRandomSource;
+// otherwise the random numbers drawn after loading will differ.
+func (cpu *CPU) SaveState(writer io.Writer) error {
+	state := stateV2{
+		Memory:    cpu.Memory,
+		Pixels:    cpu.Pixels.pixels,
+		Registers: cpu.captureRegisters(),
+		Random:    cpu.randomState(),
+	}
+	header := stateHeader{Magic: stateMagic, Version: StateVersion}
+	if err := binary.Write(writer, binary.BigEndian, &header); err != nil {
+		return err
+	}
+	return binary.Write(writer, binary.BigEndian, &state)
+}
+
+// Restores a snapshot of the machine state previously written by SaveState.
+// The CPU is left untouched if the state cannot be read in its entirety.
+func (cpu *CPU) LoadState(reader io.Reader) error {
+	var header stateHeader
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrNotState
+		}
+		return err
+	}
+	if header.Magic != stateMagic {
+		return ErrNotState
+	}
+
+	// earlier versions are upgraded as they're read
+	state := new(stateV2)
+	var err error
+	switch header.Version {
+	case 1:
+		legacy := new(stateV1)
+		err = binary.Read(reader, binary.BigEndian, legacy)
+		state = legacy.upgrade()
+	case 2:
+		err = binary.Read(reader, binary.BigEndian, state)
+	default:
+		return fmt.Errorf("unsupported save state version %d", header.Version)
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if err := state.Registers.validate(); err != nil {
+		return err
+	}
+
+	cpu.Memory = state.Memory
+	cpu.Pixels.pixels = state.Pixels
+	cpu.restoreRegisters(state.Registers)
+	cpu.Keypad.restore(state.Registers.Keys)
+	cpu.restoreRandomState(state.Random)
+	return nil
+}
+
+// Computes a CRC-32 checksum of the machine state; memory, pixels, registers
+// and the random source. Identical runs produce identical checksums.
+func (cpu *CPU) Checksum() uint32 {
+	hash := crc32.NewIEEE()
+	hash.Write(cpu.Memory[:cpu.memorySize()])
+	hash.Write(cpu.Pixels.pixels[:])
+	registers := cpu.captureRegisters()
+	binary.Write(hash, binary.BigEndian, &registers)
+	binary.Write(hash, binary.BigEndian, cpu.randomState())
+	return hash.Sum32()
+}
+
+// Retrieves the state of the random source, or zero if it has none.
+func (cpu *CPU) randomState() uint64 {
+	if source, ok := cpu.Random.(StatefulRandomSource); ok {
+		return source.State()
+	}
+	return 0
+}
+
+// Restores the state of the random source, if it has one and the state was captured.
+func (cpu *CPU) restoreRandomState(state uint64) {
+	if source, ok := cpu.Random.(StatefulRandomSource); ok && state != 0 {
+		source.SetState(state)
+	}
+}
+
+// Captures everything in the machine state besides memory and pixels.
+func (cpu *CPU) captureRegisters() registerState {
+	return registerState{
+		V:       cpu.V,
+		I:       cpu.I,
+		PC:      cpu.PC,
+		SP:      cpu.SP,
+		Stack:   cpu.Stack,
+		DT:      cpu.DT,
+		ST:      cpu.ST,
+		Keys:    cpu.Keypad.snapshot(),
+		HiRes:   cpu.Pixels.hiRes,
+		Flags:   cpu.Flags,
+		Exited:  cpu.Exited,
+		Planes:  cpu.Planes,
+		Pattern: cpu.Pattern,
+		Pitch:   cpu.Pitch,
+		KeyWait: cpu.KeyWait,
+	}
+}
+
+// Restores everything captured by captureRegisters, besides the keys;
+// the keypad belongs to the host, and is restored separately where appropriate.
+func (cpu *CPU) restoreRegisters(registers registerState) {
+	cpu.V = registers.V
+	cpu.I = registers.I
+	cpu.PC = registers.PC
+	cpu.SP = registers.SP
+	cpu.Stack = registers.Stack
+	cpu.DT, cpu.ST = registers.DT, registers.ST
+	cpu.Pixels.hiRes = registers.HiRes
+	cpu.Flags = registers.Flags
+	cpu.Exited = registers.Exited
+	cpu.Planes = registers.Planes
+	cpu.Pattern = registers.Pattern
+	cpu.Pitch = registers.Pitch
+	cpu.KeyWait = registers.KeyWait
+}
+
+// Checks the registers are within the ranges the CPU relies upon.
+func (registers *registerState) validate() error {
+	if int(registers.SP) >= len(registers.Stack) || int(registers.Planes) > AllPlanes || int(registers.KeyWait.Key) >= KeyCount {
+		return errors.New("corrupt save state")
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Asserts that a saved state restores the machine exactly, leaving its configuration alone.
+func TestSaveState(t *testing.T) {
+	cpu := NewCPU()
+	cpu.LoadProgram(subroutineProgram)
+	cpu.Quirks = VIPQuirks
+	for i := 0; i < 7; i++ {
+		if err := cpu.NextCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cpu.I = 0x300
+	cpu.DT, cpu.ST = 20, 10
+	cpu.Pixels.setHiRes(true)
+	cpu.Pixels.writeSprite(fontSet[:5], 8, 10, 10, 1, true)
+	cpu.Keypad.Press(0x5)
+	cpu.KeyWait = KeyWait{Pressed: true, Key: 0x5}
+	cpu.Random.RandomByte()
+
+	var saved bytes.Buffer
+	if err := cpu.SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	expected := *cpu
+
+	// restore over a fresh CPU with its own configuration
+	restored := NewCPU()
+	if err := restored.LoadState(bytes.NewReader(saved.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Quirks != ModernQuirks {
+		t.Error("Loading a state should preserve the quirks profile")
+	}
+	restored.Quirks = expected.Quirks
+	keypad := restored.Keypad
+	restored.Keypad = expected.Keypad
+	random := restored.Random
+	restored.Random = expected.Random
+	if *restored != expected {
+		t.Error("The restored CPU differs from the saved one")
+	}
+	assertEquals(t, "random draw", random.RandomByte(), cpu.Random.RandomByte())
+	assertEquals(t, "Stack[1]", restored.Stack[1], 0x202)
+	if !keypad.IsPressed(0x5) || keypad.IsPressed(0x6) {
+		t.Error("The keypad state was not restored")
+	}
+}
+
+// Asserts that anything other than a complete, current save state is rejected untouched.
+func TestLoadStateErrors(t *testing.T) {
+	var saved bytes.Buffer
+	if err := NewCPU().SaveState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	valid := saved.Bytes()
+
+	tests := map[string][]byte{
+		"empty":     {},
+		"magic":     append([]byte("NOPE"), valid[4:]...),
+		"version":   append(append([]byte(nil), valid[:4]...), append([]byte{0xFF, 0xFF}, valid[6:]...)...),
+		"truncated": valid[:len(valid)-1],
+	}
+	for name, data := range tests {
+		cpu := NewCPU()
+		cpu.V[0] = 0x42
+		if err := cpu.LoadState(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected the %s state to be rejected", name)
+		}
+		assertEquals(t, name+" V0", cpu.V[0], 0x42)
+	}
+}
+
+// Writes a version 1 state as the first builds to save states did, field by
+// field: memory, then the registers and keys, then the pixels and the rest.
+func writeVersion1State(buffer *bytes.Buffer) {
+	var memory [65536]byte
+	memory[0x200], memory[0x201] = 0x12, 0x04
+	var v [16]byte
+	v[0x0], v[0xF] = 0x11, 0x01
+	var stack [12]uint16
+	stack[0] = 0x202
+	var keys [KeyCount]bool
+	keys[0x5] = true
+	var pixels [HiResWidth * HiResHeight]byte
+	pixels[0], pixels[len(pixels)-1] = 1, 3
+	var flags, pattern [16]byte
+	flags[0], pattern[0] = 0x07, 0xAA
+
+	for _, field := range []interface{}{
+		stateHeader{Magic: stateMagic, Version: 1},
+		memory,
+		v,
+		uint16(0x300), // I
+		uint16(0x204), // PC
+		byte(1),       // SP
+		stack,
+		byte(20), byte(10), // DT, ST
+		keys,
+		pixels,
+		true, // HiRes
+		flags,
+		false,   // Exited
+		byte(1), // Planes
+		pattern,
+		byte(64), // Pitch
+		KeyWait{Pressed: true, Key: 0x5},
+	} {
+		binary.Write(buffer, binary.BigEndian, field)
+	}
+}
+
+// Asserts that version 1 states, which predate the random source, still load,
+// with their fields read in the order they were written.
+func TestLoadStateVersion1(t *testing.T) {
+	var saved bytes.Buffer
+	writeVersion1State(&saved)
+
+	cpu := NewCPU()
+	expected := NewRandomSource(1).RandomByte()
+	if err := cpu.LoadState(&saved); err != nil {
+		t.Fatal(err)
+	}
+	assertEquals(t, "random draw", cpu.Random.RandomByte(), expected)
+	assertEquals(t, "Memory[0x200]", cpu.Memory[0x200], 0x12)
+	assertEquals(t, "Memory[0x201]", cpu.Memory[0x201], 0x04)
+	assertEquals(t, "V0", cpu.V[0x0], 0x11)
+	assertEquals(t, "VF", cpu.V[0xF], 0x01)
+	assertEquals(t, "I", cpu.I, 0x300)
+	assertEquals(t, "PC", cpu.PC, 0x204)
+	assertEquals(t, "SP", cpu.SP, 1)
+	assertEquals(t, "Stack[0]", cpu.Stack[0], 0x202)
+	assertEquals(t, "DT", cpu.DT, 20)
+	assertEquals(t, "ST", cpu.ST, 10)
+	assertEquals(t, "first pixel", cpu.Pixels.pixels[0], 1)
+	assertEquals(t, "last pixel", cpu.Pixels.pixels[len(cpu.Pixels.pixels)-1], 3)
+	assertEquals(t, "Flags[0]", cpu.Flags[0], 0x07)
+	assertEquals(t, "Planes", cpu.Planes, 1)
+	assertEquals(t, "Pattern[0]", cpu.Pattern[0], 0xAA)
+	assertEquals(t, "Pitch", cpu.Pitch, 64)
+	assertEquals(t, "KeyWait.Key", byte(cpu.KeyWait.Key), 0x5)
+	if !cpu.Pixels.hiRes || cpu.Exited || !cpu.KeyWait.Pressed {
+		t.Error("The flags of the version 1 state were misread")
+	}
+	if !cpu.Keypad.IsPressed(0x5) || cpu.Keypad.IsPressed(0x6) {
+		t.Error("The keys of the version 1 state were misread")
+	}
+}
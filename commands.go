@@ -0,0 +1,101 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8/asm"
+	"bitbucket.org/mattklein/chip8emu/chip8/disasm"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A subcommand of the emulator, invoked with its own arguments.
+type command func(args []string)
+
+// The subcommands available in addition to running a program interactively.
+var commands = map[string]command{
+	"assemble": assembleCommand,
+	"config":   configCommand,
+	"disasm":   disasmCommand,
+	"run":      runProgramCommand,
+}
+
+// Runs the subcommand named on the command line, if any.
+// Returns false if the interactive emulator should be started instead.
+func runCommand() bool {
+	if len(os.Args) < 2 {
+		return false
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		return false
+	}
+	command(os.Args[2:])
+	return true
+}
+
+// Disassembles a program to the standard output.
+// Usage: chip8emu disasm [-origin address] <rom>
+func disasmCommand(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	origin := flags.Uint("origin", 0x200, "The address the program is loaded at")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		log.Fatal("A program to disassemble was expected")
+	}
+
+	listing := disasm.Disassemble(readFile(flags.Arg(0)), uint16(*origin))
+	if _, err := listing.WriteTo(os.Stdout); err != nil {
+		log.Fatal("Failed to write the listing. ", err)
+	}
+}
+
+// Assembles a program from source, optionally writing a map of its symbols.
+// Usage: chip8emu assemble [-origin address] [-o output] [-symbols file] <source>
+func assembleCommand(args []string) {
+	flags := flag.NewFlagSet("assemble", flag.ExitOnError)
+	origin := flags.Uint("origin", 0x200, "The address the program is loaded at")
+	output := flags.String("o", "", "The path to write the program to; defaults to the source with a .bin extension")
+	symbols := flags.String("symbols", "", "The path to write a map of the program's symbols to, if any")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		log.Fatal("A source file to assemble was expected")
+	}
+	source := flags.Arg(0)
+	if *output == "" {
+		*output = strings.TrimSuffix(source, filepath.Ext(source)) + ".bin"
+	}
+
+	program, err := asm.Assemble(source, readFile(source), uint16(*origin))
+	if err != nil {
+		// report each error on its own line, as file:line: message
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(*output, program.Bytes, 0644); err != nil {
+		log.Fatal("Failed to write the program. ", err)
+	}
+
+	if *symbols != "" {
+		file, err := os.Create(*symbols)
+		if err != nil {
+			log.Fatal("Failed to create the symbol map. ", err)
+		}
+		defer file.Close()
+		if err := program.WriteSymbols(file); err != nil {
+			log.Fatal("Failed to write the symbol map. ", err)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The settings of the emulator, as read from its configuration file; e.g.
+//
+//	{
+//	  "width": 1280,
+//	  "height": 640,
+//	  "palette": "amber",
+//	  "layout": "azerty",
+//	  "keymap": {"Space": "5"},
+//	  "audio": {"volume": 0.5},
+//	  "hotkeys": {"pause": "Pause"},
+//	  "gamepad": {"deadzone": 0.4, "mapping": {"start": "F"}}
+//	}
+//
+// Each setting overrides the emulator's default and the recommended settings of
+// known programs, but is itself overridden by the command line. Omitted settings
+// are left alone.
+type config struct {
+	Width   int               `json:"width,omitempty"`   // The width of the window.
+	Height  int               `json:"height,omitempty"`  // The height of the window.
+	Display string            `json:"display,omitempty"` // Where to show the display; window or terminal.
+	Speed   uint              `json:"speed,omitempty"`   // The number of instructions to execute per frame.
+	Quirks  string            `json:"quirks,omitempty"`  // The name of the quirks profile.
+	Palette string            `json:"palette,omitempty"` // The colours of the display; see chip8.ParsePalette.
+	Rewind  *uint             `json:"rewind,omitempty"`  // The number of seconds which may be rewound.
+	Audio   audioConfig       `json:"audio"`             // The sound of the sound timer.
+	Layout  string            `json:"layout,omitempty"`  // The name of the preset keymap; see chip8.Layouts.
+	Keymap  map[string]string `json:"keymap,omitempty"`  // The hexadecimal keypad key of host keys, by SDL key name, remapped on top of the layout.
+	Hotkeys map[string]string `json:"hotkeys,omitempty"` // The SDL key name of each of the emulator's own actions.
+	Gamepad gamepadConfig     `json:"gamepad"`           // The keys pressed with game controllers.
+}
+
+// The settings of the sound timer's tone.
+type audioConfig struct {
+	Tone   float64  `json:"tone,omitempty"`   // The frequency, in hertz.
+	Volume *float64 `json:"volume,omitempty"` // The volume, from 0 (muted) to 1.
+}
+
+// The settings of game controllers.
+type gamepadConfig struct {
+	Deadzone *float64          `json:"deadzone,omitempty"` // The fraction of a stick's travel ignored around its centre.
+	Mapping  map[string]string `json:"mapping,omitempty"`  // The hexadecimal keypad key of inputs, by name, remapped on top of the default; see chip8.GamepadMapping.
+}
+
+// The host keys controlling the emulator itself, rather than the program.
+type hotkeyMap struct {
+	Pause   sdl.Keycode // Toggles pausing.
+	Step    sdl.Keycode // Steps a single instruction.
+	Reset   sdl.Keycode // Starts the program over.
+	Rewind  sdl.Keycode // Plays backwards whilst held.
+	Capture sdl.Keycode // Starts and stops capturing.
+	Quit    sdl.Keycode // Exits the emulator.
+}
+
+// the hotkeys, as configured
+var hotkeys = hotkeyMap{
+	Pause:   sdl.K_p,
+	Step:    sdl.K_n,
+	Reset:   sdl.K_BACKSPACE,
+	Rewind:  sdl.K_TAB,
+	Capture: sdl.K_F12,
+	Quit:    sdl.K_ESCAPE,
+}
+
+// Retrieves the hotkeys by the names they're configured with.
+func (keys *hotkeyMap) byName() map[string]*sdl.Keycode {
+	return map[string]*sdl.Keycode{
+		"pause":   &keys.Pause,
+		"step":    &keys.Step,
+		"reset":   &keys.Reset,
+		"rewind":  &keys.Rewind,
+		"capture": &keys.Capture,
+		"quit":    &keys.Quit,
+	}
+}
+
+// The path of the configuration file in the user's configuration directory.
+func configFilename() string {
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		dir = os.Getenv("AppData")
+	case "darwin":
+		dir = filepath.Join(os.Getenv("HOME"), "Library", "Application Support")
+	default:
+		if dir = os.Getenv("XDG_CONFIG_HOME"); dir == "" {
+			dir = filepath.Join(os.Getenv("HOME"), ".config")
+		}
+	}
+	return filepath.Join(dir, "chip8emu", "config.json")
+}
+
+// Reads the configuration file; a missing file is an empty configuration.
+func readConfig(filename string) (*config, error) {
+	settings := new(config)
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return settings, nil
+}
+
+// Applies the settings to the flags which haven't been set already, and to the
+// hotkeys. Returns an error naming any setting the flags reject, or any unknown
+// key or hotkey. The keymap is applied once the program's own keymap is known;
+// see buildKeycodes.
+func (settings *config) apply(flags *flag.FlagSet) error {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var invalid error
+	setting := func(name, value string) {
+		if set[name] || invalid != nil {
+			return
+		}
+		if err := flags.Set(name, value); err != nil {
+			invalid = fmt.Errorf("invalid %s %q: %v", name, value, err)
+		}
+	}
+	if settings.Width != 0 {
+		setting("width", strconv.Itoa(settings.Width))
+	}
+	if settings.Height != 0 {
+		setting("height", strconv.Itoa(settings.Height))
+	}
+	if settings.Display != "" {
+		setting("display", settings.Display)
+	}
+	if settings.Speed != 0 {
+		setting("speed", strconv.FormatUint(uint64(settings.Speed), 10))
+	}
+	if settings.Quirks != "" {
+		setting("quirks", settings.Quirks)
+	}
+	if settings.Palette != "" {
+		setting("palette", settings.Palette)
+	}
+	if settings.Rewind != nil {
+		setting("rewind", strconv.FormatUint(uint64(*settings.Rewind), 10))
+	}
+	if settings.Audio.Tone != 0 {
+		setting("tone", strconv.FormatFloat(settings.Audio.Tone, 'g', -1, 64))
+	}
+	if settings.Audio.Volume != nil {
+		setting("volume", strconv.FormatFloat(*settings.Audio.Volume, 'g', -1, 64))
+	}
+	if settings.Gamepad.Deadzone != nil {
+		setting("deadzone", strconv.FormatFloat(*settings.Gamepad.Deadzone, 'g', -1, 64))
+	}
+	if settings.Layout != "" {
+		setting("layout", settings.Layout)
+	}
+	if invalid != nil {
+		return invalid
+	}
+
+	actions := hotkeys.byName()
+	for action, name := range settings.Hotkeys {
+		hotkey, ok := actions[action]
+		if !ok {
+			return fmt.Errorf("unknown hotkey %q; expected one of %s", action, hotkeyNames())
+		}
+		if *hotkey = sdl.GetKeyFromName(name); *hotkey == sdl.K_UNKNOWN {
+			return fmt.Errorf("unknown key %q for the %s hotkey", name, action)
+		}
+	}
+	return nil
+}
+
+// Captures the settings in effect, from the flags, keymap and hotkeys.
+func effectiveConfig() *config {
+	volume, rewind, deadzone := *volumeFlag, *rewindFlag, *deadzoneFlag
+	settings := &config{
+		Width:   *widthFlag,
+		Height:  *heightFlag,
+		Display: *displayFlag,
+		Speed:   *speedFlag,
+		Quirks:  *quirksFlag,
+		Palette: *paletteFlag,
+		Rewind:  &rewind,
+		Audio:   audioConfig{Tone: *toneFlag, Volume: &volume},
+		Layout:  *layoutFlag,
+		Keymap:  make(map[string]string),
+		Hotkeys: make(map[string]string),
+		Gamepad: gamepadConfig{Deadzone: &deadzone, Mapping: make(map[string]string)},
+	}
+	for host, key := range keycodes {
+		settings.Keymap[sdl.GetKeyName(host)] = fmt.Sprintf("%X", key)
+	}
+	for input, key := range gamepadMapping {
+		settings.Gamepad.Mapping[input] = fmt.Sprintf("%X", key)
+	}
+	for action, hotkey := range hotkeys.byName() {
+		settings.Hotkeys[action] = sdl.GetKeyName(*hotkey)
+	}
+	return settings
+}
+
+// Prints the configuration in effect, after applying the configuration file to
+// the flags, as a configuration file. No program is loaded, so the dump doesn't
+// include the recommended settings of any particular program.
+// Usage: chip8emu config dump [flags]
+func configCommand(args []string) {
+	if len(args) == 0 || args[0] != "dump" {
+		log.Fatal("Usage: chip8emu config dump [flags]")
+	}
+	flag.CommandLine.Parse(args[1:])
+	applySettings(applyConfig(), chip8.ROMInfo{})
+
+	text, err := json.MarshalIndent(effectiveConfig(), "", "  ")
+	if err != nil {
+		log.Fatal("Failed to encode the configuration. ", err)
+	}
+	fmt.Println(string(text))
+}
+
+// Reports each hotkey which is also mapped onto the keypad, as pressing it does
+// both.
+func reportHotkeyCollisions() {
+	actions := hotkeys.byName()
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if key, ok := keycodes[*actions[name]]; ok {
+			log.Printf("The %s hotkey, %s, also presses key %X of the keypad", name, sdl.GetKeyName(*actions[name]), key)
+		}
+	}
+}
+
+// Lists the names of the hotkeys, for usage messages.
+func hotkeyNames() string {
+	var names []string
+	for name := range hotkeys.byName() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
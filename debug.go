@@ -0,0 +1,311 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"bitbucket.org/mattklein/chip8emu/chip8/disasm"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The help text for the debugger's command line.
+const debugHelp = `Commands (addresses are hexadecimal):
+  c, continue                    resume until something triggers the debugger
+  p, pause                       pause the machine
+  s, step [count]                execute one or more instructions
+  rs, rstep [count]              undo one or more of the most recently executed instructions
+  n, next                        step over a CALL
+  o, out                         run until the current subroutine returns
+  b, break <address>             pause before executing the instruction at address
+  w, watch <address> [length] [r|w|rw]
+                                 pause when memory is read or written (default rw)
+  when <register> <op> <value>   pause when a condition becomes true, e.g. when V3 == #10
+  clear <address>|when           remove breakpoints and watchpoints at address, or all conditions
+  l, list                        list breakpoints, watchpoints and conditions
+  r, regs                        show the registers and stack
+  m, mem <address> [length]      dump memory
+  d, dis [address] [count]       disassemble instructions, from PC by default
+  q, quit                        exit the emulator
+An empty line repeats the previous command.`
+
+// A command line for the debugger, reading commands from the input and writing to the output.
+type debugConsole struct {
+	machine  *chip8.Machine
+	debugger *chip8.Debugger
+	output   io.Writer
+	quit     func() // Exits the emulator.
+}
+
+// Runs the debugger's command line until the input is closed or the user quits.
+// Stops triggered whilst the machine runs are reported as they occur.
+func runDebugger(machine *chip8.Machine, debugger *chip8.Debugger, input io.Reader, output io.Writer, quit func()) {
+	console := &debugConsole{machine: machine, debugger: debugger, output: output, quit: quit}
+
+	// read commands in the background, so stops can be reported whilst waiting
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(input)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	fmt.Fprintln(output, "The machine is paused; type help for a list of commands.")
+	console.showLocation()
+	previous := ""
+	for {
+		fmt.Fprint(output, "(chip8) ")
+		select {
+		case stop := <-debugger.Stops():
+			fmt.Fprintf(output, "\nStopped at %03X: %s\n", stop.PC, stop.Reason)
+			console.showLocation()
+
+		case line, ok := <-lines:
+			if !ok {
+				return
+			}
+			if strings.TrimSpace(line) == "" {
+				line = previous
+			}
+			previous = line
+			if !console.execute(strings.Fields(line)) {
+				return
+			}
+		}
+	}
+}
+
+// Executes a single command, returning false if the user quit.
+func (console *debugConsole) execute(fields []string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+	args := fields[1:]
+	var err error
+
+	switch fields[0] {
+	case "help", "h", "?":
+		fmt.Fprintln(console.output, debugHelp)
+
+	case "continue", "c":
+		console.debugger.Continue()
+
+	case "pause", "p":
+		console.debugger.Pause()
+		console.showLocation()
+
+	case "step", "s":
+		count := 1
+		if len(args) > 0 {
+			count, err = strconv.Atoi(args[0])
+		}
+		for i := 0; i < count && err == nil; i++ {
+			err = console.debugger.Step()
+		}
+		console.showLocation()
+
+	case "rstep", "rs":
+		count := 1
+		if len(args) > 0 {
+			count, err = strconv.Atoi(args[0])
+		}
+		for i := 0; i < count && err == nil; i++ {
+			err = console.debugger.ReverseStep()
+		}
+		console.showLocation()
+
+	case "next", "n":
+		err = console.debugger.StepOver()
+		if console.machine.IsPaused() {
+			console.showLocation()
+		}
+
+	case "out", "o":
+		err = console.debugger.StepOut()
+
+	case "break", "b":
+		var address uint16
+		if address, err = parseAddress(args, 0); err == nil {
+			console.debugger.Break(address)
+		}
+
+	case "watch", "w":
+		err = console.watch(args)
+
+	case "when":
+		var condition chip8.Condition
+		if condition, err = chip8.ParseCondition(strings.Join(args, " ")); err == nil {
+			console.debugger.BreakWhen(condition)
+		}
+
+	case "clear":
+		if len(args) == 1 && args[0] == "when" {
+			console.debugger.ClearConditions()
+			break
+		}
+		var address uint16
+		if address, err = parseAddress(args, 0); err == nil && !console.debugger.Clear(address) {
+			err = fmt.Errorf("nothing is set at %03X", address)
+		}
+
+	case "list", "l":
+		console.list()
+
+	case "regs", "r":
+		console.showRegisters()
+
+	case "mem", "m":
+		err = console.dumpMemory(args)
+
+	case "dis", "d":
+		err = console.disassemble(args)
+
+	case "quit", "q":
+		console.quit()
+		return false
+
+	default:
+		err = fmt.Errorf("unknown command %s; type help for a list of commands", fields[0])
+	}
+
+	if err != nil {
+		fmt.Fprintln(console.output, err)
+	}
+	return true
+}
+
+// Adds a watchpoint from the arguments: address [length] [r|w|rw].
+func (console *debugConsole) watch(args []string) error {
+	address, err := parseAddress(args, 0)
+	if err != nil {
+		return err
+	}
+	watchpoint := chip8.Watchpoint{Address: address, Length: 1, Kind: chip8.WatchAccess}
+	for _, arg := range args[1:] {
+		switch arg {
+		case "r":
+			watchpoint.Kind = chip8.WatchRead
+		case "w":
+			watchpoint.Kind = chip8.WatchWrite
+		case "rw":
+			watchpoint.Kind = chip8.WatchAccess
+		default:
+			if watchpoint.Length, err = strconv.Atoi(arg); err != nil || watchpoint.Length < 1 {
+				return fmt.Errorf("invalid length %s", arg)
+			}
+		}
+	}
+	console.debugger.Watch(watchpoint)
+	return nil
+}
+
+// Lists the breakpoints, watchpoints and conditions.
+func (console *debugConsole) list() {
+	breakpoints, watchpoints, conditions := console.debugger.List()
+	for _, address := range breakpoints {
+		fmt.Fprintf(console.output, "break %03X\n", address)
+	}
+	for _, watchpoint := range watchpoints {
+		fmt.Fprintf(console.output, "watch %03X %d (%s)\n", watchpoint.Address, watchpoint.Length, watchpoint.Kind)
+	}
+	for _, condition := range conditions {
+		fmt.Fprintf(console.output, "when %s\n", condition)
+	}
+}
+
+// Shows the registers, and the instruction at the program counter.
+func (console *debugConsole) showLocation() {
+	console.showRegisters()
+	console.machine.Do(func(cpu *chip8.CPU) {
+		instruction := disasm.Decode(cpu.Memory[:], 0, cpu.PC)
+		fmt.Fprintf(console.output, "%03X: %04X  %s\n", cpu.PC, instruction.Opcode, instruction)
+	})
+}
+
+// Shows the registers and stack.
+func (console *debugConsole) showRegisters() {
+	console.machine.Do(func(cpu *chip8.CPU) {
+		for i, value := range cpu.V {
+			fmt.Fprintf(console.output, "V%X=%02X ", i, value)
+			if i == 7 || i == 15 {
+				fmt.Fprintln(console.output)
+			}
+		}
+		fmt.Fprintf(console.output, "I=%03X PC=%03X SP=%X DT=%02X ST=%02X stack=%03X\n",
+			cpu.I, cpu.PC, cpu.SP, cpu.DT, cpu.ST, cpu.Stack[1:cpu.SP+1])
+	})
+}
+
+// Dumps memory from the arguments: address [length].
+func (console *debugConsole) dumpMemory(args []string) error {
+	address, err := parseAddress(args, 0)
+	if err != nil {
+		return err
+	}
+	length := 16
+	if len(args) > 1 {
+		if length, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid length %s", args[1])
+		}
+	}
+	console.machine.Do(func(cpu *chip8.CPU) {
+		for offset := 0; offset < length && int(address)+offset < len(cpu.Memory); offset += 16 {
+			start := int(address) + offset
+			end := start + 16
+			if end > int(address)+length {
+				end = int(address) + length
+			}
+			if end > len(cpu.Memory) {
+				end = len(cpu.Memory)
+			}
+			fmt.Fprintf(console.output, "%03X: % X\n", start, cpu.Memory[start:end])
+		}
+	})
+	return nil
+}
+
+// Disassembles instructions from the arguments: [address] [count].
+func (console *debugConsole) disassemble(args []string) error {
+	count := 8
+	var address uint16
+	var err error
+	console.machine.Do(func(cpu *chip8.CPU) { address = cpu.PC })
+	if len(args) > 0 {
+		if address, err = parseAddress(args, 0); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		if count, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid count %s", args[1])
+		}
+	}
+	console.machine.Do(func(cpu *chip8.CPU) {
+		for i := 0; i < count; i++ {
+			instruction := disasm.Decode(cpu.Memory[:], 0, address)
+			fmt.Fprintf(console.output, "%03X: %04X  %s\n", address, instruction.Opcode, instruction)
+			address += uint16(instruction.Size)
+		}
+	})
+	return nil
+}
+
+// Parses the hexadecimal address at the given argument, which may be prefixed with # or 0x.
+func parseAddress(args []string, index int) (uint16, error) {
+	if index >= len(args) {
+		return 0, fmt.Errorf("an address was expected")
+	}
+	text := strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(args[index]), "#"), "0x")
+	address, err := strconv.ParseUint(text, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %s", args[index])
+	}
+	return uint16(address), nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"github.com/veandco/go-sdl2/sdl"
+	"image/color"
+)
+
+// A display presenting frames in an SDL window, scaled to fill it.
+type sdlDisplay struct {
+	window   *sdl.Window   // The main window.
+	renderer *sdl.Renderer // The window's renderer.
+	texture  *sdl.Texture  // A render target of the display's resolution; nil until resized.
+	palette  [4]color.RGBA // The colours of each pixel value.
+}
+
+// Opens a window of the given dimensions; SDL's video subsystem must have been initialized.
+func newSDLDisplay(width, height int) (*sdlDisplay, error) {
+	window, err := sdl.CreateWindow("chip8emu", 100, 100, int32(width), int32(height), sdl.WINDOW_SHOWN)
+	if err != nil {
+		return nil, err
+	}
+	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED)
+	if err != nil {
+		window.Destroy()
+		return nil, err
+	}
+	return &sdlDisplay{window: window, renderer: renderer}, nil
+}
+
+// Recreates the render target texture at the given resolution.
+func (display *sdlDisplay) Resize(width, height int) error {
+	texture, err := display.renderer.CreateTexture(sdl.PIXELFORMAT_RGBA8888, sdl.TEXTUREACCESS_TARGET, int32(width), int32(height))
+	if err != nil {
+		return err
+	}
+	if display.texture != nil {
+		display.texture.Destroy()
+	}
+	display.texture = texture
+	return nil
+}
+
+// Selects the colours of each pixel value.
+func (display *sdlDisplay) SetPalette(palette [4]color.RGBA) error {
+	display.palette = palette
+	return nil
+}
+
+// Draws the frame to the texture, then stretches it over the window.
+func (display *sdlDisplay) Present(frame *chip8.Bitmap) error {
+	renderer := display.renderer
+	renderer.SetRenderTarget(display.texture)
+	background := display.palette[0]
+	renderer.SetDrawColor(background.R, background.G, background.B, background.A)
+	renderer.Clear()
+
+	for x := 0; x < frame.Width(); x++ {
+		for y := 0; y < frame.Height(); y++ {
+			// draw active pixels in the colour of their planes
+			if value := frame.GetPixel(x, y); value > 0 {
+				color := display.palette[value&chip8.AllPlanes]
+				renderer.SetDrawColor(color.R, color.G, color.B, color.A)
+				renderer.DrawPoint(int32(x), int32(y))
+			}
+		}
+	}
+
+	renderer.SetRenderTarget(nil)
+	renderer.Copy(display.texture, nil, nil)
+	renderer.Present()
+	return nil
+}
+
+// Destroys the window and everything drawn to it.
+func (display *sdlDisplay) Close() {
+	if display.texture != nil {
+		display.texture.Destroy()
+	}
+	display.renderer.Destroy()
+	display.window.Destroy()
+}
@@ -0,0 +1,72 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"github.com/veandco/go-sdl2/sdl"
+	"log"
+)
+
+// The game controllers plugged in, which are opened as they're connected and
+// closed as they're disconnected; SDL reports those connected at startup too.
+// Only the joysticks SDL knows the layout of are game controllers, so others
+// are ignored until they're given a mapping, through SDL's
+// SDL_GAMECONTROLLERCONFIG environment variable.
+type controllers struct {
+	gamepads *chip8.Gamepads                        // Translates their buttons and axes into keys.
+	open     map[sdl.JoystickID]*sdl.GameController // The controllers open, by instance ID.
+}
+
+// Builds a new set of controllers, pressing keys through the given input.
+func newControllers(input chip8.KeyInput) *controllers {
+	return &controllers{
+		gamepads: chip8.NewGamepads(input, gamepadMapping, *deadzoneFlag),
+		open:     make(map[sdl.JoystickID]*sdl.GameController),
+	}
+}
+
+// Handles a game controller event, connecting, disconnecting or passing on the
+// input of a controller.
+func (pads *controllers) handle(event sdl.Event) {
+	switch e := event.(type) {
+	case *sdl.ControllerDeviceEvent:
+		switch e.Type {
+		case sdl.CONTROLLERDEVICEADDED:
+			// which is the device index, rather than the instance ID, when added
+			controller := sdl.GameControllerOpen(int(e.Which))
+			if controller == nil {
+				log.Print("Failed to open game controller. ", sdl.GetError())
+				return
+			}
+			pads.open[controller.Joystick().InstanceID()] = controller
+			log.Printf("Connected %s", controller.Name())
+
+		case sdl.CONTROLLERDEVICEREMOVED:
+			if controller, ok := pads.open[e.Which]; ok {
+				log.Printf("Disconnected %s", controller.Name())
+				controller.Close()
+				delete(pads.open, e.Which)
+			}
+			pads.gamepads.Disconnect(int32(e.Which))
+		}
+
+	case *sdl.ControllerButtonEvent:
+		name := sdl.GameControllerGetStringForButton(sdl.GameControllerButton(e.Button))
+		pads.gamepads.Button(int32(e.Which), name, e.State == sdl.PRESSED)
+
+	case *sdl.ControllerAxisEvent:
+		name := sdl.GameControllerGetStringForAxis(sdl.GameControllerAxis(e.Axis))
+		pads.gamepads.Axis(int32(e.Which), name, e.Value)
+	}
+}
+
+// Closes every controller still open.
+func (pads *controllers) close() {
+	for id, controller := range pads.open {
+		controller.Close()
+		delete(pads.open, id)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"encoding/json"
+	"flag"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The registers and progress of a headless run, as dumped to JSON.
+type registerDump struct {
+	Frames int      `json:"frames"`          // The number of frames completed.
+	Exited bool     `json:"exited"`          // Whether the program exited.
+	Fault  string   `json:"fault,omitempty"` // The fault which stopped the run, if any.
+	V      [16]byte `json:"v"`
+	I      uint16   `json:"i"`
+	PC     uint16   `json:"pc"`
+	SP     byte     `json:"sp"`
+	Stack  []uint16 `json:"stack"` // The return addresses on the stack, innermost last.
+	DT     byte     `json:"dt"`
+	ST     byte     `json:"st"`
+	HiRes  bool     `json:"hires"`
+}
+
+// Runs a program without a window, dumping the final display and registers.
+// The sound is discarded unless written to a WAV file with -audio, and every
+// frame may be captured to a GIF or Y4M video with -capture.
+// Usage: chip8emu run --headless [-frames n] [-keys script] [-screen file] [-registers file] [-audio file] [-capture file] <rom>
+func runProgramCommand(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	headless := flags.Bool("headless", false, "Run without a window; currently required")
+	frames := flags.Int("frames", 600, "The number of 60hz frames to run for")
+	speed := flags.Uint("speed", 10, "The number of instructions to execute per 60hz frame")
+	quirks := flags.String("quirks", "modern", "The quirks profile to emulate (vip, chip48, schip, xochip or modern)")
+	seed := flags.Int64("seed", 1, "The seed for the random numbers drawn by the program")
+	keys := flags.String("keys", "", "A script of key events such as \"60:5 90+1 120-1\", or @file to read one from a file")
+	screen := flags.String("screen", "-", "The path to write the final display to; a PNG for .png files, text otherwise, or - for the standard output")
+	scale := flags.Int("scale", 8, "The size of each pixel in PNG output, and of each high resolution pixel in captures")
+	palette := flags.String("palette", "default", "The colours of the PNG output and captures; a name (default, amber or green) or four hexadecimal colours")
+	registers := flags.String("registers", "", "The path to write the final registers to as JSON, or - for the standard output")
+	audio := flags.String("audio", "", "The path to write the sound played to as a WAV file")
+	tone := flags.Float64("tone", 440, "The frequency of the sound timer's tone, in hertz")
+	capture := flags.String("capture", "", "The path to capture every frame to; an animated GIF for .gif files, or a video for .y4m files")
+	address := flags.Uint("address", chip8.ProgramStart, "The address to load the program at and start it from; 0x600 for ETI 660 programs")
+	strict := flags.Bool("strict", false, "Reject programs of an odd length, which are often truncated or corrupt")
+	romdb := flags.String("romdb", "programs/roms.json", "The path to a database of the recommended settings of known programs")
+	flags.Parse(args)
+
+	if !*headless {
+		flags.Usage()
+		log.Fatal("The run subcommand only supports --headless; run without a subcommand for a window")
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		log.Fatal("A program to run was expected")
+	}
+	program := readFile(flags.Arg(0))
+	applyROMInfo(flags, *romdb, program)
+	profile, ok := chip8.QuirksProfiles[*quirks]
+	if !ok {
+		flags.Usage()
+		log.Fatal("A valid quirks profile was expected")
+	}
+	colours, err := chip8.ParsePalette(*palette)
+	if err != nil {
+		flags.Usage()
+		log.Fatal("A valid palette was expected. ", err)
+	}
+
+	// scripts may be given inline, or read from a file
+	text := *keys
+	if strings.HasPrefix(text, "@") {
+		text = string(readFile(text[1:]))
+	}
+	script, err := chip8.ParseKeyScript(text)
+	if err != nil {
+		log.Fatal("Failed to parse the key script. ", err)
+	}
+	if *address > 0xFFFF {
+		flags.Usage()
+		log.Fatal("A valid load address was expected")
+	}
+	if extension := strings.ToLower(filepath.Ext(*capture)); *capture != "" && extension != ".gif" && extension != ".y4m" {
+		flags.Usage()
+		log.Fatal("A valid capture file (.gif or .y4m) was expected")
+	}
+
+	// the outputs are only created once the program has loaded
+	cpu := chip8.NewCPU()
+	cpu.Quirks = profile
+	cpu.Random = chip8.NewRandomSource(*seed)
+	if err := cpu.LoadProgramWith(program, chip8.LoadOptions{Address: uint16(*address), AllowOddLength: !*strict}); err != nil {
+		log.Fatal("Failed to load program. ", err)
+	}
+	var sink *chip8.WAVSink
+	if *audio != "" {
+		file, err := os.Create(*audio)
+		if err != nil {
+			log.Fatal("Failed to create audio file. ", err)
+		}
+		defer file.Close()
+		if sink, err = chip8.NewWAVSink(file, chip8.NewSynthesizer(*tone, 1)); err != nil {
+			log.Fatal("Failed to write audio file. ", err)
+		}
+		cpu.Audio = sink
+	}
+	var captureScreen *chip8.Screen
+	var video chip8.Capture
+	if *capture != "" {
+		file, err := os.Create(*capture)
+		if err != nil {
+			log.Fatal("Failed to create capture file. ", err)
+		}
+		defer file.Close()
+		if video, err = chip8.NewCapture(*capture, file, *scale); err != nil {
+			log.Fatal("Failed to start capture. ", err)
+		}
+		captureScreen = chip8.NewScreen(video)
+		captureScreen.SetPalette(colours)
+	}
+	completed, fault := cpu.RunFrames(*frames, *speed, script, captureScreen)
+	if _, ok := fault.(*chip8.Fault); fault != nil && !ok {
+		log.Fatal("Failed to capture frame. ", fault)
+	}
+	if video != nil {
+		if err := video.Close(); err != nil {
+			log.Fatal("Failed to write capture file. ", err)
+		}
+	}
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			log.Fatal("Failed to write audio file. ", err)
+		}
+	}
+
+	// dump whatever state was reached, even if the CPU faulted
+	if *screen != "" {
+		writeOutput(*screen, func(writer io.Writer) error {
+			if strings.EqualFold(filepath.Ext(*screen), ".png") {
+				return png.Encode(writer, cpu.Pixels.PaletteImage(*scale, colours))
+			}
+			_, err := io.WriteString(writer, cpu.Pixels.String())
+			return err
+		})
+	}
+	if *registers != "" {
+		dump := registerDump{
+			Frames: completed,
+			Exited: cpu.Exited,
+			V:      cpu.V,
+			I:      cpu.I,
+			PC:     cpu.PC,
+			SP:     cpu.SP,
+			Stack:  cpu.Stack[1 : cpu.SP+1],
+			DT:     cpu.DT,
+			ST:     cpu.ST,
+			HiRes:  cpu.Pixels.IsHiRes(),
+		}
+		if fault != nil {
+			dump.Fault = fault.Error()
+		}
+		writeOutput(*registers, func(writer io.Writer) error {
+			encoder := json.NewEncoder(writer)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(dump)
+		})
+	}
+
+	if fault != nil {
+		log.Fatal("The processor faulted. ", fault)
+	}
+}
+
+// Writes output to the named file, or the standard output for -.
+func writeOutput(filename string, write func(writer io.Writer) error) {
+	writer := io.Writer(os.Stdout)
+	if filename != "-" {
+		file, err := os.Create(filename)
+		if err != nil {
+			log.Fatal("Failed to create output file. ", err)
+		}
+		defer file.Close()
+		writer = file
+	}
+	if err := write(writer); err != nil {
+		log.Fatal("Failed to write output. ", err)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Builds the mapping of SDL to Chip-8 key codes from the named layout, with
+// the host keys of each of the overrides remapped in turn.
+func buildKeycodes(layout string, overrides ...map[string]string) (map[sdl.Keycode]chip8.Keycode, error) {
+	keymap, ok := chip8.Layouts[layout]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %s; expected one of %s", layout, chip8.LayoutNames())
+	}
+	keycodes := make(map[sdl.Keycode]chip8.Keycode)
+	if err := resolveKeymap(keycodes, keymap); err != nil {
+		return nil, err
+	}
+	for _, entries := range overrides {
+		override, err := chip8.ParseKeymap(entries)
+		if err != nil {
+			return nil, err
+		}
+		if err := resolveKeymap(keycodes, override); err != nil {
+			return nil, err
+		}
+	}
+	return keycodes, nil
+}
+
+// Adds the keymap's host keys to the mapping, by their SDL key codes.
+func resolveKeymap(keycodes map[sdl.Keycode]chip8.Keycode, keymap chip8.Keymap) error {
+	for name, key := range keymap {
+		host := sdl.GetKeyFromName(name)
+		if host == sdl.K_UNKNOWN {
+			return fmt.Errorf("unknown key %q in keymap", name)
+		}
+		keycodes[host] = key
+	}
+	return nil
+}
@@ -6,64 +6,195 @@ package main
 
 import (
 	"bitbucket.org/mattklein/chip8emu/chip8"
+	"bufio"
+	"context"
 	"flag"
+	"fmt"
 	"github.com/veandco/go-sdl2/sdl"
 	"io/ioutil"
 	"log"
+	"os"
+	"time"
 )
 
 var ( // Command line flags and arguments
-	filenameFlag  = flag.String("filename", "programs/GAMES/MERLIN", "The path to the program to load into the interpreter")
-	widthFlag     = flag.Int("width", 1024, "The width of the window")
-	heightFlag    = flag.Int("height", 768, "The height of the window")
-	frequencyFlag = flag.Uint("frequency", 60, "The frequency, in hertz, to run the processor at")
+	filenameFlag = flag.String("filename", "programs/GAMES/MERLIN", "The path to the program to load into the interpreter")
+	widthFlag    = flag.Int("width", 1024, "The width of the window")
+	heightFlag   = flag.Int("height", 768, "The height of the window")
+	speedFlag    = flag.Uint("speed", 10, "The number of instructions to execute per 60hz frame")
+	quirksFlag   = flag.String("quirks", "modern", "The quirks profile to emulate (vip, chip48, schip, xochip or modern)")
+	seedFlag     = flag.Int64("seed", 0, "The seed for the random numbers drawn by programs; 0 picks one from the clock")
+	rewindFlag   = flag.Uint("rewind", 10, "The number of seconds of play which may be rewound by holding tab; 0 disables rewinding")
+	recordFlag   = flag.String("record", "", "The path to record a movie of the session's input to")
+	replayFlag   = flag.String("replay", "", "The path of a movie to replay; its settings override -quirks, -seed, -speed, -address and -strict")
+	debugFlag    = flag.Bool("debug", false, "Pause at startup and accept debugger commands on the standard input")
+	toneFlag     = flag.Float64("tone", 440, "The frequency of the sound timer's tone, in hertz")
+	volumeFlag   = flag.Float64("volume", 0.25, "The volume of the sound, from 0 (muted) to 1")
+	displayFlag  = flag.String("display", "window", "Where to show the display; a window, or the terminal for working remotely")
+	paletteFlag  = flag.String("palette", "default", "The colours of the display; a name (default, amber or green) or four hexadecimal colours")
+	captureFlag  = flag.String("capture", "gif", "The format of the captures started and stopped with the capture hotkey; gif or y4m")
+	scaleFlag    = flag.Int("capturescale", 4, "The size of each high resolution pixel in captures")
+	romdbFlag    = flag.String("romdb", "programs/roms.json", "The path to a database of the recommended settings of known programs")
+	addressFlag  = flag.Uint("address", chip8.ProgramStart, "The address to load the program at and start it from; 0x600 for ETI 660 programs")
+	configFlag   = flag.String("config", configFilename(), "The path to the configuration file, whose settings are overridden by the command line")
+	layoutFlag   = flag.String("layout", "qwerty", "The preset keymap to play with (qwerty, azerty, numpad or hp48)")
+	deadzoneFlag = flag.Float64("deadzone", 0.25, "The fraction of a gamepad stick's travel ignored around its centre, from 0 to 1")
+	strictFlag   = flag.Bool("strict", false, "Reject programs of an odd length, which are often truncated or corrupt")
 )
 
 // the singleton chip 8 cpu
 var cpu = chip8.NewCPU()
 
-// A mapping of SDL to Chip-8 key codes.
-var keycodes = map[sdl.Keycode]chip8.Keycode{
-	sdl.K_1: 0x01, sdl.K_2: 0x02, sdl.K_3: 0x03, sdl.K_4: 0x0C,
-	sdl.K_q: 0x04, sdl.K_w: 0x05, sdl.K_e: 0x06, sdl.K_r: 0x0D,
-	sdl.K_a: 0x07, sdl.K_s: 0x08, sdl.K_d: 0x09, sdl.K_f: 0x0E,
-	sdl.K_z: 0x0A, sdl.K_x: 0x00, sdl.K_c: 0x0B, sdl.K_v: 0x0F,
-}
+// the colours of the display, as chosen on the command line
+var palette = chip8.Palette
+
+// A mapping of SDL to Chip-8 key codes, as built from the layout and keymaps
+// chosen; keys which aren't mapped are ignored.
+var keycodes map[sdl.Keycode]chip8.Keycode
+
+// the keys pressed by gamepad buttons and sticks, as chosen for the program
+var gamepadMapping = chip8.DefaultGamepadMapping
 
 // Entry point for the interpreter
 func main() {
-	parseCommandLine()
+	// run a subcommand instead, if one was given
+	if runCommand() {
+		return
+	}
 
-	// load a test program and start it executing in the background
-	cpu.LoadProgram(readFile(*filenameFlag))
-	go cpu.RunAtFrequency(*frequencyFlag)
+	program := parseCommandLine(os.Args[1:])
 
-	// start winding up SDL
-	sdl.Init(sdl.INIT_VIDEO)
+	// a replay dictates everything that influences the emulation
+	var replay *chip8.Movie
+	if *replayFlag != "" {
+		replay = readMovie(*replayFlag, program)
+		*quirksFlag, *seedFlag, *speedFlag = replay.Quirks, replay.Seed, replay.Speed
+		*addressFlag = uint(replay.Address)
+		// the program loaded when it was recorded, whatever its length
+		*strictFlag = false
+	}
 
-	// create the main window
-	window, err := sdl.CreateWindow("chip8emu", 100, 100, int32(*widthFlag), int32(*heightFlag), sdl.WINDOW_SHOWN)
-	if err != nil {
-		log.Fatal("Failed to create main window. ", err)
+	// select the interpretation of ambiguous instructions
+	cpu.Quirks = chip8.QuirksProfiles[*quirksFlag]
+
+	// seed the random numbers, reporting the seed so that a run may be reproduced
+	seed := *seedFlag
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+		log.Printf("Seeding random numbers with -seed %d", seed)
 	}
-	defer window.Destroy()
+	cpu.Random = chip8.NewRandomSource(seed)
 
-	// create the main renderer
-	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED)
-	if err != nil {
-		log.Fatal("Failed to create main renderer. ", err)
+	// start winding up SDL; only its audio and game controllers are needed in a terminal
+	subsystems := uint32(sdl.INIT_VIDEO | sdl.INIT_AUDIO | sdl.INIT_GAMECONTROLLER)
+	if *displayFlag == "terminal" {
+		subsystems = sdl.INIT_AUDIO | sdl.INIT_GAMECONTROLLER
+	}
+	sdl.Init(subsystems)
+
+	// play the sound timer's tone, carrying on silently without a sound card
+	if *volumeFlag > 0 {
+		sink, err := newSDLSink(*toneFlag, *volumeFlag)
+		if err != nil {
+			log.Print("Failed to open audio device. ", err)
+		} else {
+			cpu.Audio = sink
+			defer sink.Close()
+		}
+	}
+
+	// load the program given on the command line, at the address and with the
+	// strictness its settings direct, ready to run in the background
+	machine := chip8.NewMachine(cpu, *speedFlag)
+	options := chip8.LoadOptions{Address: uint16(*addressFlag), AllowOddLength: !*strictFlag}
+	if err := machine.LoadProgramWith(program, options); err != nil {
+		log.Fatal("Failed to load program. ", err)
 	}
-	defer renderer.Destroy()
 
-	// create a texture mimicking the default dimensions of the chip8 display
-	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_RGBA8888, sdl.TEXTUREACCESS_TARGET, chip8.Width, chip8.Height)
+	// movies need an uninterrupted session, so jumping between states is disabled
+	input := chip8.KeyInput(cpu.Keypad)
+	var player *chip8.MoviePlayer
+	movieSession := *recordFlag != "" || replay != nil
+	if *recordFlag != "" {
+		movie := &chip8.Movie{
+			ROM:     chip8.HashProgram(program),
+			Seed:    seed,
+			Quirks:  *quirksFlag,
+			Speed:   *speedFlag,
+			Address: uint16(*addressFlag),
+		}
+		recorder := chip8.NewMovieRecorder(movie)
+		machine.Observe(recorder)
+		input = recorder
+		defer machine.Do(func(*chip8.CPU) { writeMovie(*recordFlag, movie) })
+	}
+	if replay != nil {
+		player = chip8.NewMoviePlayer(replay)
+		machine.Observe(player)
+		input = ignoredInput{}
+	}
+
+	if *rewindFlag > 0 && !movieSession {
+		machine.EnableRewind(int(*rewindFlag) * chip8.FrameRate)
+	}
+	if *debugFlag {
+		debugger := chip8.NewDebugger(machine)
+		go runDebugger(machine, debugger, os.Stdin, os.Stdout, func() {
+			sdl.PushEvent(&sdl.QuitEvent{Type: sdl.QUIT})
+		})
+	}
+	go func() {
+		err := machine.Run(context.Background())
+		if _, ok := err.(*chip8.DesyncError); ok {
+			log.Fatal("The replay failed. ", err)
+		}
+	}()
+	// faults pause the machine, which may then be reset
+	go func() {
+		for fault := range machine.Faults() {
+			log.Print("The processor faulted. ", fault)
+		}
+	}()
+	defer machine.Stop()
+
+	// keys stay pressed whilst any host key or gamepad input mapped to them is held
+	input = chip8.NewKeyCounter(input)
+
+	// show the display in a window, or in the terminal when working remotely
+	if *displayFlag == "terminal" {
+		runTerminal(machine, input, player, movieSession)
+	} else {
+		runWindow(machine, input, player, movieSession)
+	}
+
+	sdl.Quit()
+}
+
+// Shows the machine's display in a window, passing on the keys pressed whilst it has focus
+// and the input of any game controllers, until the window is closed or escape is pressed.
+func runWindow(machine *chip8.Machine, input chip8.KeyInput, player *chip8.MoviePlayer, movieSession bool) {
+	// open the main window, presenting frames through a screen so that
+	// changes of resolution are followed
+	display, err := newSDLDisplay(*widthFlag, *heightFlag)
 	if err != nil {
-		log.Fatal("Failed to create main texture. ", err)
+		log.Fatal("Failed to create main window. ", err)
 	}
-	defer texture.Destroy()
+	defer display.Close()
+	screen := chip8.NewScreen(display)
+	screen.SetPalette(palette)
+
+	// capture the frames shown whilst toggled on by the capture hotkey
+	var capture *windowCapture
+	defer func() { capture.stop() }()
+
+	// press keys with game controllers too, as they're plugged in
+	pads := newControllers(input)
+	defer pads.close()
 
 	// run the main event loop
 	running := true
+	rewinding, wasPaused := false, false
+	replayed := false
 	for running {
 		// process incoming events
 		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
@@ -71,43 +202,146 @@ func main() {
 			case *sdl.QuitEvent:
 				running = false
 
+			case *sdl.ControllerDeviceEvent, *sdl.ControllerButtonEvent, *sdl.ControllerAxisEvent:
+				pads.handle(e)
+
 			case *sdl.KeyboardEvent:
-				// exit if escape is pressed
-				if e.Keysym.Sym == sdl.K_ESCAPE {
+				// exit if the quit hotkey is pressed
+				if e.Keysym.Sym == hotkeys.Quit {
 					running = false
 				}
-				if e.State == sdl.PRESSED {
-					cpu.Keypad.Press(keycodes[e.Keysym.Sym])
+				// held keys repeat, which mustn't toggle pausing or reload states over and over
+				if e.State == sdl.PRESSED && e.Repeat == 0 {
+					handleHotkey(machine, e.Keysym, movieSession)
+				}
+				if e.Keysym.Sym == hotkeys.Capture && e.State == sdl.PRESSED && e.Repeat == 0 {
+					if capture == nil {
+						capture = startCapture(machine)
+					} else {
+						capture.stop()
+						capture = nil
+					}
 				}
-				if e.State == sdl.RELEASED {
-					cpu.Keypad.Release(keycodes[e.Keysym.Sym])
+				// play backwards whilst the rewind hotkey is held
+				if e.Keysym.Sym == hotkeys.Rewind && e.Repeat == 0 && !movieSession {
+					if e.State == sdl.PRESSED {
+						rewinding, wasPaused = true, machine.IsPaused()
+					} else {
+						rewinding = false
+						if !wasPaused {
+							machine.Resume()
+						}
+					}
+				}
+				// held keys repeat, but are only counted as pressed once
+				if key, ok := keycodes[e.Keysym.Sym]; ok && e.Repeat == 0 {
+					if e.State == sdl.PRESSED {
+						input.Press(key)
+					} else {
+						input.Release(key)
+					}
 				}
 			}
 		}
 
-		renderer.SetRenderTarget(texture)
-		renderer.SetDrawColor(0, 0, 0, 0)
-		renderer.Clear()
-
-		renderer.SetDrawColor(255, 255, 255, 255)
-		for x := 0; x < chip8.Width; x++ {
-			for y := 0; y < chip8.Height; y++ {
-				// draw active pixels
-				if cpu.Pixels.GetPixel(x, y) > 0 {
-					renderer.DrawPoint(int32(x), int32(y))
-				}
-			}
+		if rewinding {
+			machine.Rewind()
+		}
+		if player != nil && !replayed && player.Finished() {
+			log.Print("The replay finished without desynchronising")
+			replayed = true
 		}
 
-		renderer.Present()
-		renderer.SetRenderTarget(nil)
-		renderer.Copy(texture, nil, nil)
+		// take a consistent copy of the display from the machine, and show it
+		pixels := machine.Snapshot()
+		if err := screen.Present(&pixels); err != nil {
+			log.Fatal("Failed to present frame. ", err)
+		}
 
 		// don't eat the cpu
 		sdl.Delay(1000 / 60)
 	}
+}
 
-	sdl.Quit()
+// Pauses, resumes, steps and resets the machine in response to the given hotkey.
+// F1 to F9 load the numbered save state slots, and with shift held they save them.
+// Loading states, stepping and resetting are unavailable whilst recording or replaying a movie.
+func handleHotkey(machine *chip8.Machine, key sdl.Keysym, movieSession bool) {
+	if movieSession && (key.Sym >= sdl.K_F1 && key.Sym <= sdl.K_F9 && key.Mod&sdl.KMOD_SHIFT == 0 || key.Sym == hotkeys.Reset || key.Sym == hotkeys.Step) {
+		log.Print("Jumping between states and stepping are unavailable whilst recording or replaying a movie")
+		return
+	}
+	if key.Sym >= sdl.K_F1 && key.Sym <= sdl.K_F9 {
+		slot := int(key.Sym-sdl.K_F1) + 1
+		if key.Mod&sdl.KMOD_SHIFT != 0 {
+			saveState(machine, slot)
+		} else {
+			loadState(machine, slot)
+		}
+		return
+	}
+
+	switch key.Sym {
+	case hotkeys.Pause: // toggle pause
+		if machine.IsPaused() {
+			machine.Resume()
+		} else {
+			machine.Pause()
+		}
+
+	case hotkeys.Step: // step a single instruction
+		if err := machine.Step(); err != nil {
+			log.Print("Failed to step. ", err)
+		}
+
+	case hotkeys.Reset: // start over
+		if err := machine.Reset(); err != nil {
+			log.Print("Failed to reset. ", err)
+		}
+	}
+}
+
+// The file holding the given save state slot for the current program.
+func stateFilename(slot int) string {
+	return fmt.Sprintf("%s.%d.state", *filenameFlag, slot)
+}
+
+// Saves the state of the machine into the given slot.
+func saveState(machine *chip8.Machine, slot int) {
+	file, err := os.Create(stateFilename(slot))
+	if err != nil {
+		log.Print("Failed to create save state. ", err)
+		return
+	}
+	defer file.Close()
+
+	machine.Do(func(cpu *chip8.CPU) {
+		err = cpu.SaveState(file)
+	})
+	if err != nil {
+		log.Print("Failed to write save state. ", err)
+		return
+	}
+	log.Printf("Saved state to slot %d", slot)
+}
+
+// Restores the state of the machine from the given slot.
+func loadState(machine *chip8.Machine, slot int) {
+	file, err := os.Open(stateFilename(slot))
+	if err != nil {
+		log.Print("Failed to open save state. ", err)
+		return
+	}
+	defer file.Close()
+
+	machine.Do(func(cpu *chip8.CPU) {
+		err = cpu.LoadState(bufio.NewReader(file))
+	})
+	if err != nil {
+		log.Print("Failed to read save state. ", err)
+		return
+	}
+	log.Printf("Loaded state from slot %d", slot)
 }
 
 // Reads all of the bytes from the given file.
@@ -119,15 +353,40 @@ func readFile(filename string) []byte {
 	return bytes
 }
 
-// Parse and validate command line arguments.
-func parseCommandLine() {
-	flag.Parse()
+// Parse and validate command line arguments, returning the program to run.
+// The configuration file supplies the settings which weren't given on the
+// command line, then known programs supply those which remain; so settings
+// come from the command line, the configuration file, the ROM database and
+// the defaults, in that order of precedence.
+func parseCommandLine(args []string) []byte {
+	flag.CommandLine.Parse(args)
 
 	if *filenameFlag == "" {
 		flag.Usage()
 		log.Fatal("A valid filename was expected")
 	}
+	program := readFile(*filenameFlag)
+	settings := applyConfig()
+	info := applyROMInfo(flag.CommandLine, *romdbFlag, program)
+	applySettings(settings, info)
+	return program
+}
 
+// Reads the configuration file, applying it to the flags which haven't been set.
+func applyConfig() *config {
+	settings, err := readConfig(*configFlag)
+	if err != nil {
+		log.Fatal("Failed to read configuration file. ", err)
+	}
+	if err := settings.apply(flag.CommandLine); err != nil {
+		log.Fatalf("Failed to apply configuration file. %s: %v", *configFlag, err)
+	}
+	return settings
+}
+
+// Validates the settings in effect, and builds the palette, keymap and gamepad
+// mapping from them along with the recommendations for the program.
+func applySettings(settings *config, info chip8.ROMInfo) {
 	if *widthFlag == 0 {
 		flag.Usage()
 		log.Fatal("A valid width was expected")
@@ -138,8 +397,71 @@ func parseCommandLine() {
 		log.Fatal("A valid height was expected")
 	}
 
-	if *frequencyFlag == 0 {
+	if *speedFlag == 0 {
+		flag.Usage()
+		log.Fatal("A valid speed was expected")
+	}
+
+	if *addressFlag > 0xFFFF {
+		flag.Usage()
+		log.Fatal("A valid load address was expected")
+	}
+
+	if *displayFlag != "window" && *displayFlag != "terminal" {
+		flag.Usage()
+		log.Fatal("A valid display (window or terminal) was expected")
+	}
+
+	// the debugger steps and rewinds outside of the frames a movie accounts for
+	if *debugFlag && (*recordFlag != "" || *replayFlag != "") {
+		flag.Usage()
+		log.Fatal("The debugger is unavailable whilst recording or replaying a movie")
+	}
+
+	if *displayFlag == "terminal" && *debugFlag {
+		flag.Usage()
+		log.Fatal("The debugger is unavailable in the terminal, which needs the standard input for keys")
+	}
+
+	colours, err := chip8.ParsePalette(*paletteFlag)
+	if err != nil {
+		flag.Usage()
+		log.Fatal("A valid palette was expected. ", err)
+	}
+	palette = colours
+
+	// the configuration file's keymap takes precedence over the program's
+	if keycodes, err = buildKeycodes(*layoutFlag, info.Keymap, settings.Keymap); err != nil {
+		flag.Usage()
+		log.Fatal("A valid keymap was expected. ", err)
+	}
+	reportHotkeyCollisions()
+	for _, entries := range []map[string]string{info.Gamepad, settings.Gamepad.Mapping} {
+		mapping, err := chip8.ParseGamepadMapping(entries)
+		if err != nil {
+			flag.Usage()
+			log.Fatal("A valid gamepad mapping was expected. ", err)
+		}
+		gamepadMapping = gamepadMapping.Override(mapping)
+	}
+
+	if *deadzoneFlag < 0 || *deadzoneFlag > 1 {
+		flag.Usage()
+		log.Fatal("A valid deadzone, from 0 to 1, was expected")
+	}
+
+	if *captureFlag != "gif" && *captureFlag != "y4m" {
+		flag.Usage()
+		log.Fatal("A valid capture format (gif or y4m) was expected")
+	}
+
+	if *toneFlag <= 0 || *volumeFlag < 0 || *volumeFlag > 1 {
+		flag.Usage()
+		log.Fatal("A valid tone and volume were expected")
+	}
+
+	if _, ok := chip8.QuirksProfiles[*quirksFlag]; !ok {
 		flag.Usage()
-		log.Fatal("A valid frequency was expected")
+		log.Fatal("A valid quirks profile was expected")
 	}
 }
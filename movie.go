@@ -0,0 +1,55 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"log"
+	"os"
+)
+
+// Discards host input, whilst a replay drives the keypad instead.
+type ignoredInput struct{}
+
+// Discards key presses whilst a movie is replaying.
+func (ignoredInput) Press(key chip8.Keycode) {}
+
+// Discards key releases whilst a movie is replaying.
+func (ignoredInput) Release(key chip8.Keycode) {}
+
+// Reads a movie to replay, checking it was recorded with the given program.
+func readMovie(filename string, program []byte) *chip8.Movie {
+	file, err := os.Open(filename)
+	if err != nil {
+		log.Fatal("Failed to open movie. ", err)
+	}
+	defer file.Close()
+
+	movie, err := chip8.ReadMovie(file)
+	if err != nil {
+		log.Fatal("Failed to read movie. ", err)
+	}
+	if movie.ROM != chip8.HashProgram(program) {
+		log.Fatal("The movie was recorded with a different program")
+	}
+	if _, ok := chip8.QuirksProfiles[movie.Quirks]; !ok || movie.Speed == 0 {
+		log.Fatal("The movie was recorded with invalid settings")
+	}
+	return movie
+}
+
+// Writes a recorded movie.
+func writeMovie(filename string, movie *chip8.Movie) {
+	file, err := os.Create(filename)
+	if err != nil {
+		log.Fatal("Failed to create movie. ", err)
+	}
+	defer file.Close()
+
+	if err := movie.Write(file); err != nil {
+		log.Fatal("Failed to write movie. ", err)
+	}
+	log.Printf("Recorded %d frames to %s", movie.Frames, filename)
+}
@@ -0,0 +1,60 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"flag"
+	"log"
+	"os"
+	"strconv"
+)
+
+// Looks the program up in the given ROM database, reporting its details and
+// applying its recommended settings to the flags which haven't been set, by the
+// command line or the configuration file. Returns the program's details, which
+// are empty for unknown programs; a missing database is ignored.
+func applyROMInfo(flags *flag.FlagSet, filename string, program []byte) chip8.ROMInfo {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return chip8.ROMInfo{}
+	}
+	if err != nil {
+		log.Print("Failed to open ROM database. ", err)
+		return chip8.ROMInfo{}
+	}
+	defer file.Close()
+
+	database, err := chip8.ReadROMDatabase(file)
+	if err != nil {
+		log.Print("Failed to read ROM database. ", err)
+		return chip8.ROMInfo{}
+	}
+	info, ok := database.Lookup(program)
+	if !ok {
+		return info
+	}
+
+	// the command line and configuration file take precedence over the database
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	recommend := func(name, value string) {
+		if value != "" && !given[name] && flags.Lookup(name) != nil {
+			flags.Set(name, value)
+		}
+	}
+	if info.Tickrate > 0 {
+		recommend("speed", strconv.FormatUint(uint64(info.Tickrate), 10))
+	}
+	recommend("quirks", info.Quirks)
+	recommend("palette", info.Palette)
+	recommend("layout", info.Layout)
+
+	log.Printf("Loaded %s", info)
+	if hints := info.KeyHints(); hints != "" {
+		log.Printf("Keys: %s", hints)
+	}
+	return info
+}
@@ -0,0 +1,293 @@
+// Copyright 2017, the project authors. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE.md file.
+
+package main
+
+import (
+	"bitbucket.org/mattklein/chip8emu/chip8"
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/veandco/go-sdl2/sdl"
+	"image/color"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// How long a newly pressed key is held for; long enough for the terminal to begin repeating it.
+	terminalPressHold = 500 * time.Millisecond
+	// How long a key is held for after each repeat; terminals repeat keys at 30hz or so.
+	terminalRepeatHold = 100 * time.Millisecond
+)
+
+// Control characters read from the terminal.
+const (
+	ctrlC     = 0x03
+	escape    = 0x1B
+	backspace = 0x7F
+)
+
+// A display drawing frames to a terminal with ANSI escape codes.
+// Each character cell shows two rows of pixels, as the upper half block drawn
+// in the upper pixel's colour over a background of the lower pixel's colour.
+type terminalDisplay struct {
+	out      *bufio.Writer // The terminal being drawn to.
+	palette  [4]color.RGBA // The colours of each pixel value.
+	previous chip8.Bitmap  // The last frame drawn, so that unchanged frames may be skipped.
+	drawn    bool          // Whether a frame has been drawn at the current resolution and palette.
+}
+
+// Builds a new display drawing to the given terminal.
+func newTerminalDisplay(out io.Writer) *terminalDisplay {
+	return &terminalDisplay{out: bufio.NewWriter(out)}
+}
+
+// Clears the terminal, ready to draw frames of the new resolution.
+func (display *terminalDisplay) Resize(width, height int) error {
+	display.drawn = false
+	// clear the screen and hide the cursor
+	display.out.WriteString("\x1b[2J\x1b[?25l")
+	return display.out.Flush()
+}
+
+// Selects the colours of each pixel value.
+func (display *terminalDisplay) SetPalette(palette [4]color.RGBA) error {
+	display.palette = palette
+	display.drawn = false
+	return nil
+}
+
+// Draws the frame from the top left of the terminal, unless it's unchanged.
+func (display *terminalDisplay) Present(frame *chip8.Bitmap) error {
+	if display.drawn && *frame == display.previous {
+		return nil
+	}
+	display.previous, display.drawn = *frame, true
+
+	out := display.out
+	out.WriteString("\x1b[H")
+	for y := 0; y < frame.Height(); y += 2 {
+		var upper, lower byte = 0xFF, 0xFF
+		for x := 0; x < frame.Width(); x++ {
+			// only change colours when they differ from the previous cell's
+			if value := frame.GetPixel(x, y) & chip8.AllPlanes; value != upper {
+				colour := display.palette[value]
+				fmt.Fprintf(out, "\x1b[38;2;%d;%d;%dm", colour.R, colour.G, colour.B)
+				upper = value
+			}
+			if value := frame.GetPixel(x, y+1) & chip8.AllPlanes; value != lower {
+				colour := display.palette[value]
+				fmt.Fprintf(out, "\x1b[48;2;%d;%d;%dm", colour.R, colour.G, colour.B)
+				lower = value
+			}
+			out.WriteString("▀")
+		}
+		// the terminal is raw, so return to the start of the line explicitly
+		out.WriteString("\x1b[0m\r\n")
+	}
+	return out.Flush()
+}
+
+// Restores the cursor, below the last frame drawn.
+func (display *terminalDisplay) Close() {
+	display.out.WriteString("\x1b[0m\x1b[?25h\r\n")
+	display.out.Flush()
+}
+
+// Switches the terminal on the standard input into raw mode, so that keys are
+// read as they're pressed without being echoed.
+// Returns a function restoring the terminal's previous mode.
+func makeRaw() (func(), error) {
+	stty := func(args ...string) (string, error) {
+		command := exec.Command("stty", args...)
+		command.Stdin = os.Stdin
+		output, err := command.Output()
+		return strings.TrimSpace(string(output)), err
+	}
+	mode, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(mode) }, nil
+}
+
+// A writer which ends lines with a carriage return as well as the line feed, as
+// a terminal in raw mode no longer returns to the start of the line by itself.
+type rawWriter struct {
+	out io.Writer // Where the translated output is written.
+}
+
+// Writes the data, translating each line feed.
+func (writer rawWriter) Write(data []byte) (int, error) {
+	if _, err := writer.out.Write(bytes.Replace(data, []byte("\n"), []byte("\r\n"), -1)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Reads from the standard input, sending what was read to the channel until an error occurs.
+func readTerminal(keys chan<- []byte) {
+	buffer := make([]byte, 64)
+	for {
+		n, err := os.Stdin.Read(buffer)
+		if err != nil {
+			close(keys)
+			return
+		}
+		keys <- append([]byte(nil), buffer[:n]...)
+	}
+}
+
+// Shows the machine's display in the terminal, passing on the keys typed into
+// it, until Ctrl+C or the quit hotkey is pressed.
+//
+// Terminals only report keys as they're typed, repeating them whilst they're
+// held, so each key is held until it goes unrepeated for a short while. The
+// function keys arrive as escape sequences, which are decoded for the save
+// state hotkeys; other escape sequences are ignored. Game controllers are read
+// from SDL's events, as in the window, once per frame.
+func runTerminal(machine *chip8.Machine, input chip8.KeyInput, player *chip8.MoviePlayer, movieSession bool) {
+	restore, err := makeRaw()
+	if err != nil {
+		log.Fatal("Failed to switch the terminal into raw mode. ", err)
+	}
+	defer restore()
+	log.SetOutput(rawWriter{os.Stderr})
+	defer log.SetOutput(os.Stderr)
+
+	display := newTerminalDisplay(os.Stdout)
+	defer display.Close()
+	screen := chip8.NewScreen(display)
+	screen.SetPalette(palette)
+
+	pads := newControllers(input)
+	defer pads.close()
+
+	keys := make(chan []byte)
+	go readTerminal(keys)
+	held := make(map[sdl.Keycode]time.Time) // The time each held key is released.
+	ticker := time.NewTicker(time.Second / chip8.FrameRate)
+	defer ticker.Stop()
+
+	wasPaused := false
+	replayed := false
+	for {
+		select {
+		case typed, ok := <-keys:
+			if !ok {
+				return
+			}
+			// a lone escape is the escape key, rather than the start of an
+			// escape sequence; of which only the function keys are used
+			if typed[0] == ctrlC || len(typed) == 1 && terminalKeycode(typed[0]) == hotkeys.Quit {
+				return
+			}
+			if typed[0] == escape && len(typed) > 1 {
+				if key, ok := terminalFunctionKey(string(typed[1:])); ok {
+					handleHotkey(machine, key, movieSession)
+				}
+				continue
+			}
+			now := time.Now()
+			for _, char := range typed {
+				sym := terminalKeycode(char)
+				if _, repeat := held[sym]; repeat {
+					held[sym] = now.Add(terminalRepeatHold)
+					continue
+				}
+				held[sym] = now.Add(terminalPressHold)
+
+				// play backwards whilst the rewind hotkey is held
+				if sym == hotkeys.Rewind && !movieSession {
+					wasPaused = machine.IsPaused()
+				}
+				// the keypad and hotkeys are on the same keys as in the window
+				if key, ok := keycodes[sym]; ok {
+					input.Press(key)
+				}
+				handleHotkey(machine, sdl.Keysym{Sym: sym}, movieSession)
+			}
+			continue
+
+		case now := <-ticker.C:
+			for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+				pads.handle(event)
+			}
+			for sym, release := range held {
+				if now.Before(release) {
+					continue
+				}
+				delete(held, sym)
+				if key, ok := keycodes[sym]; ok {
+					input.Release(key)
+				}
+				if sym == hotkeys.Rewind && !movieSession && !wasPaused {
+					machine.Resume()
+				}
+			}
+		}
+
+		if _, rewinding := held[hotkeys.Rewind]; rewinding && !movieSession {
+			machine.Rewind()
+		}
+		if player != nil && !replayed && player.Finished() {
+			log.Print("The replay finished without desynchronising")
+			replayed = true
+		}
+
+		// take a consistent copy of the display from the machine, and show it
+		pixels := machine.Snapshot()
+		if err := screen.Present(&pixels); err != nil {
+			log.Print("Failed to present frame. ", err)
+			return
+		}
+	}
+}
+
+// The escape sequences of the function keys, following the escape character, as
+// sent by xterm and the terminals which follow it; with shift held, the final
+// character is preceded by a ";2" modifier, e.g. "[15;2~" for shift+F5.
+var terminalFunctionKeys = map[string]sdl.Keycode{
+	"OP": sdl.K_F1, "OQ": sdl.K_F2, "OR": sdl.K_F3, "OS": sdl.K_F4,
+	"[11~": sdl.K_F1, "[12~": sdl.K_F2, "[13~": sdl.K_F3, "[14~": sdl.K_F4,
+	"[15~": sdl.K_F5, "[17~": sdl.K_F6, "[18~": sdl.K_F7, "[19~": sdl.K_F8,
+	"[20~": sdl.K_F9, "[21~": sdl.K_F10, "[23~": sdl.K_F11, "[24~": sdl.K_F12,
+	// the Linux console
+	"[[A": sdl.K_F1, "[[B": sdl.K_F2, "[[C": sdl.K_F3, "[[D": sdl.K_F4, "[[E": sdl.K_F5,
+}
+
+// Decodes the escape sequence of a function key, following the escape character,
+// along with whether shift was held; reporting false for other sequences.
+func terminalFunctionKey(sequence string) (sdl.Keysym, bool) {
+	var mod uint16
+	if i := strings.Index(sequence, ";2"); i >= 0 && i == len(sequence)-3 {
+		// shift+F1 to F4 drop the O for a 1, as in "[1;2P"
+		sequence, mod = sequence[:i]+sequence[i+2:], sdl.KMOD_LSHIFT
+		if strings.HasPrefix(sequence, "[1") && len(sequence) == 3 {
+			sequence = "O" + sequence[2:]
+		}
+	}
+	sym, ok := terminalFunctionKeys[sequence]
+	return sdl.Keysym{Sym: sym, Mod: mod}, ok
+}
+
+// The SDL keycode of a character typed into the terminal; letters are folded
+// to lower case, and the delete character sent by the backspace key is backspace.
+func terminalKeycode(char byte) sdl.Keycode {
+	switch {
+	case char == backspace:
+		return sdl.K_BACKSPACE
+	case char >= 'A' && char <= 'Z':
+		return sdl.Keycode(char - 'A' + 'a')
+	}
+	return sdl.Keycode(char)
+}